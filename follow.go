@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/metacpp/go-junit-report/parser"
+)
+
+// follower collects the packages finished so far while the input is being
+// parsed, so partial reports can be written with -follow.
+type follower struct {
+	mu       sync.Mutex
+	packages []parser.Package
+}
+
+// add adds a finished package, it is used as parser.Options.Progress.
+func (f *follower) add(pkg parser.Package) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.packages = append(f.packages, pkg)
+}
+
+// report returns a report of the packages finished so far, merged like the
+// complete report if -merge-packages is set.
+func (f *follower) report() *parser.Report {
+	f.mu.Lock()
+	report := &parser.Report{Packages: append([]parser.Package{}, f.packages...)}
+	f.mu.Unlock()
+
+	if mergePackages {
+		merged := &parser.Report{Packages: make([]parser.Package, 0)}
+		merged.Merge(report)
+		return merged
+	}
+	return report
+}
+
+// follow calls write with the report of the packages finished so far every
+// interval, until stop is closed. The returned channel is closed once it has
+// stopped, so the complete report can't be overwritten by a partial one.
+func (f *follower) follow(interval time.Duration, write func(*parser.Report) error, stop <-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := write(f.report()); err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing partial report: %s\n", err)
+				}
+			}
+		}
+	}()
+
+	return done
+}
+
+// writeFile replaces the file at path with the output of write. The output is
+// written to a temporary file first, so the file is never read while it is
+// only partially written.
+func writeFile(path string, write func(io.Writer) error) error {
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,25 @@
+package formatter
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/metacpp/go-junit-report/parser"
+)
+
+// CSVReport writes a CSV representation of the given report to w, with a
+// header row followed by a row for every test containing its package, name,
+// result, time in seconds and the coverage of its package.
+func CSVReport(report *parser.Report, w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	writer.Write([]string{"package", "test", "result", "time", "coverage"})
+	for _, pkg := range report.Packages {
+		for _, test := range pkg.Tests {
+			writer.Write([]string{pkg.Name, test.Name, test.Result.String(), FormatTime(test.Time), pkg.CoveragePct})
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,58 @@
+package formatter
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/metacpp/go-junit-report/parser"
+)
+
+// FlameGraphNode is a node of the tree written by FlameGraphReport, in the
+// shape read by flame graph tools such as d3-flame-graph.
+type FlameGraphNode struct {
+	Name     string           `json:"name"`
+	Value    float64          `json:"value"`
+	Children []FlameGraphNode `json:"children,omitempty"`
+}
+
+// FlameGraphReport writes the timing of the given report to w as a JSON tree
+// of flame graph nodes. The root node has a child for every package, which
+// has a child for every test. Tests with Terraform creation and destroy
+// times have a child for each step. Values are durations in seconds.
+func FlameGraphReport(report *parser.Report, w io.Writer) error {
+	root := FlameGraphNode{Name: "all"}
+
+	for _, pkg := range report.Packages {
+		pkgNode := FlameGraphNode{Name: pkg.Name, Value: pkg.Time}
+
+		for _, test := range pkg.Tests {
+			if test.IsSubtest() {
+				// the time of subtests is included in their top-level test
+				continue
+			}
+
+			testNode := FlameGraphNode{Name: test.Name, Value: test.Time}
+			if test.CreationTime > 0 || test.TimesEstimated {
+				testNode.Children = []FlameGraphNode{
+					{Name: "creation", Value: test.CreationTime},
+					{Name: "destroy", Value: test.DestroyTime},
+				}
+			}
+			pkgNode.Children = append(pkgNode.Children, testNode)
+		}
+
+		root.Value += pkg.Time
+		root.Children = append(root.Children, pkgNode)
+	}
+
+	bytes, err := json.Marshal(root)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(w)
+	writer.Write(bytes)
+	writer.WriteByte('\n')
+	return writer.Flush()
+}
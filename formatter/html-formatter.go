@@ -0,0 +1,90 @@
+package formatter
+
+import (
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/metacpp/go-junit-report/parser"
+)
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"lower":      strings.ToLower,
+	"formatTime": FormatTime,
+	"join":       strings.Join,
+	"isFailure":  func(r parser.Result) bool { return r == parser.FAIL },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Test report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+td, th { border: 1px solid #ddd; padding: 4px 8px; text-align: left; }
+tr.pass { background: #e6ffed; }
+tr.fail { background: #ffeef0; }
+tr.skip { background: #fff8c5; }
+pre { margin: 0; white-space: pre-wrap; }
+summary { cursor: pointer; font-weight: bold; margin: 1em 0 0.5em; }
+</style>
+</head>
+<body>
+<h1>Test report</h1>
+<p>Total: {{.Total}}, passed: {{.Passed}}, failed: {{.Failures}}, skipped: {{.Skipped}}{{if .Coverage}}, coverage: {{.Coverage}}%{{end}}</p>
+{{range .Packages}}<details{{if .Failed}} open{{end}}>
+<summary>{{.Name}} ({{len .Tests}} tests, {{formatTime .Time}}s{{if .CoveragePct}}, coverage: {{.CoveragePct}}%{{end}})</summary>
+<table>
+<tr><th>Test</th><th>Result</th><th>Time</th></tr>
+{{range .Tests}}<tr class="{{lower .Result.String}}"><td>{{.Name}}</td><td>{{.Result}}</td><td>{{formatTime .Time}}</td></tr>
+{{if isFailure .Result}}<tr class="fail"><td colspan="3"><pre>{{join .Output "\n"}}</pre></td></tr>
+{{end}}{{end}}</table>
+</details>
+{{end}}</body>
+</html>
+`))
+
+type htmlReport struct {
+	*parser.Report
+	Coverage string
+	Packages []htmlPackage
+}
+
+type htmlPackage struct {
+	parser.Package
+	Failed bool
+}
+
+// HTMLReport writes a self-contained HTML page for the given report to w. It
+// starts with the number of tests per result and the total coverage, or the
+// mean coverage of all packages reporting it if there is none, followed by a collapsible table of the tests of every
+// package. Packages with failures are expanded and the output of failed tests
+// is shown below them. All output is escaped.
+func HTMLReport(report *parser.Report, w io.Writer) error {
+	data := htmlReport{Report: report}
+
+	var coverage float64
+	covered := 0
+	for _, pkg := range report.Packages {
+		p := htmlPackage{Package: pkg}
+		for _, test := range pkg.Tests {
+			if test.Result == parser.FAIL {
+				p.Failed = true
+			}
+		}
+		data.Packages = append(data.Packages, p)
+
+		if pct, err := strconv.ParseFloat(pkg.CoveragePct, 64); err == nil {
+			coverage += pct
+			covered++
+		}
+	}
+	if total, ok := report.Coverage(); ok {
+		data.Coverage = strconv.FormatFloat(total, 'f', 1, 64)
+	} else if covered > 0 {
+		data.Coverage = strconv.FormatFloat(coverage/float64(covered), 'f', 1, 64)
+	}
+
+	return htmlTemplate.Execute(w, data)
+}
@@ -0,0 +1,265 @@
+package formatter
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/metacpp/go-junit-report/parser"
+)
+
+// JSONSchemaVersion is the schemaVersion of the documents written by
+// JSONReport. It is increased whenever the document changes in a way
+// consumers have to handle.
+const JSONSchemaVersion = 1
+
+// JSONDocument is the document written by JSONReport. It starts with the
+// schema version, the time the report was generated, the Go version and the
+// number of tests per result, followed by the packages of the report.
+type JSONDocument struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	GeneratedAt   string           `json:"generatedAt,omitempty"`
+	GoVersion     string           `json:"goVersion"`
+	Tests         int              `json:"tests"`
+	Passed        int              `json:"passed"`
+	Failed        int              `json:"failed"`
+	Skipped       int              `json:"skipped"`
+	TotalCoverage string           `json:"totalCoverage,omitempty"`
+	Packages      []parser.Package `json:"packages"`
+}
+
+// JSONReport writes a JSON representation of the given report to w. The
+// report is written as a single JSONDocument. Packages and their tests are
+// written in the order of the report, which for parsed reports is the order
+// they appeared in the go test output.
+func JSONReport(report *parser.Report, w io.Writer) error {
+	return JSONReportWithOptions(report, "", Options{}, w)
+}
+
+// JSONReportIndent is like JSONReport, but indents the JSON with two spaces
+// so it can be read and diffed line by line.
+func JSONReportIndent(report *parser.Report, w io.Writer) error {
+	return JSONReportWithOptions(report, "", Options{JSONIndent: true}, w)
+}
+
+// JSONReportWithOptions is like JSONReport, but allows changing the written
+// report using opts. The generatedAt time is opts.Timestamp and is omitted
+// when zero. When goVersion is empty, the version of the Go runtime is used.
+func JSONReportWithOptions(report *parser.Report, goVersion string, opts Options, w io.Writer) error {
+	if goVersion == "" {
+		goVersion = DefaultGoVersion()
+	}
+
+	doc := JSONDocument{
+		SchemaVersion: JSONSchemaVersion,
+		GoVersion:     goVersion,
+		Tests:         report.Total(),
+		Passed:        report.Passed(),
+		Failed:        report.Failures(),
+		Skipped:       report.Skipped(),
+		TotalCoverage: report.TotalCoverage,
+		Packages:      make([]parser.Package, 0, len(report.Packages)),
+	}
+	if !opts.Timestamp.IsZero() {
+		doc.GeneratedAt = opts.Timestamp.Format(time.RFC3339)
+	}
+
+	// make sure packages without tests are written as empty arrays
+	for _, pkg := range report.Packages {
+		if pkg.Tests == nil {
+			pkg.Tests = []*parser.Test{}
+		}
+		doc.Packages = append(doc.Packages, pkg)
+	}
+
+	var v interface{} = doc
+	if opts.JSONNested {
+		v = JSONNestedDocument{JSONDocument: doc, Packages: nestPackages(doc.Packages)}
+	}
+
+	marshal := json.Marshal
+	if opts.JSONIndent {
+		marshal = func(v interface{}) ([]byte, error) {
+			return json.MarshalIndent(v, "", "  ")
+		}
+	}
+
+	bytes, err := marshal(v)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(w)
+	writer.Write(bytes)
+	writer.WriteByte('\n')
+	return writer.Flush()
+}
+
+// JSONNestedDocument is the document written by JSONReportWithOptions with
+// Options.JSONNested. It is a JSONDocument whose packages only contain their
+// top-level tests, with the subtests of every test nested below it.
+type JSONNestedDocument struct {
+	JSONDocument
+	Packages []JSONNestedPackage `json:"packages"`
+}
+
+// JSONNestedPackage is a package of a JSONNestedDocument.
+type JSONNestedPackage struct {
+	parser.Package
+	Tests []*JSONNestedTest `json:"tests"`
+}
+
+// JSONNestedTest is a test of a JSONNestedDocument. It is written like a
+// parser.Test, with an additional subtests array.
+type JSONNestedTest struct {
+	*parser.Test
+	Subtests []*JSONNestedTest `json:"subtests"`
+}
+
+// MarshalJSON encodes the test like parser.Test and adds its subtests.
+func (t *JSONNestedTest) MarshalJSON() ([]byte, error) {
+	test, err := json.Marshal(t.Test)
+	if err != nil {
+		return nil, err
+	}
+
+	subtests := t.Subtests
+	if subtests == nil {
+		subtests = []*JSONNestedTest{}
+	}
+	data, err := json.Marshal(subtests)
+	if err != nil {
+		return nil, err
+	}
+
+	// the test is encoded as an object, add the subtests before its closing
+	// brace
+	test = append(test[:len(test)-1], `,"subtests":`...)
+	test = append(test, data...)
+	return append(test, '}'), nil
+}
+
+// nestPackages returns the packages with the subtests of every test nested
+// below their parent. Tests whose parent is not part of the package are
+// kept at the top level.
+func nestPackages(packages []parser.Package) []JSONNestedPackage {
+	nested := make([]JSONNestedPackage, 0, len(packages))
+	for _, pkg := range packages {
+		p := JSONNestedPackage{Package: pkg, Tests: []*JSONNestedTest{}}
+
+		byName := make(map[string]*JSONNestedTest)
+		for _, test := range pkg.Tests {
+			t := &JSONNestedTest{Test: test}
+			byName[test.Name] = t
+
+			if parent, ok := byName[test.Parent]; ok && test.Parent != "" {
+				parent.Subtests = append(parent.Subtests, t)
+			} else {
+				p.Tests = append(p.Tests, t)
+			}
+		}
+
+		nested = append(nested, p)
+	}
+	return nested
+}
+
+// JSONFlatReport writes the tests of every package in the given report to w
+// as comma separated JSON arrays, one array per package. This is the shape
+// written by earlier versions of JSONReport and is only kept so existing
+// consumers can migrate.
+//
+// Deprecated: the output is not a valid JSON document, use JSONReport
+// instead.
+func JSONFlatReport(report *parser.Report, w io.Writer) error {
+	writer := bufio.NewWriter(w)
+
+	for i, pkg := range report.Packages {
+		tests := pkg.Tests
+		if tests == nil {
+			tests = []*parser.Test{}
+		}
+
+		bytes, err := json.Marshal(tests)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			writer.WriteByte(',')
+		}
+		writer.Write(bytes)
+	}
+
+	writer.WriteByte('\n')
+	return writer.Flush()
+}
+
+// JSONCoverageDocument is the document written by JSONCoverageReport. Each
+// package contains its coverage next to the test results, so the document can
+// be ingested by coverage dashboards without a separate coverage profile.
+//
+//	{
+//	  "packages": [
+//	    {
+//	      "name": "package/name",
+//	      "time": 0.16,
+//	      "coverage": {"percent": 13.37, "mode": "set"},
+//	      "tests": [ ... ]
+//	    }
+//	  ]
+//	}
+//
+// The coverage object is null for packages that did not report coverage, the
+// mode is omitted when it is unknown.
+type JSONCoverageDocument struct {
+	Packages []JSONCoveragePackage `json:"packages"`
+}
+
+// JSONCoveragePackage contains the results and coverage of a single package.
+type JSONCoveragePackage struct {
+	Name     string         `json:"name"`
+	Time     float64        `json:"time"`
+	Coverage *JSONCoverage  `json:"coverage"`
+	Tests    []*parser.Test `json:"tests"`
+}
+
+// JSONCoverage contains the statement coverage of a package.
+type JSONCoverage struct {
+	Percent float64 `json:"percent"`
+	Mode    string  `json:"mode,omitempty"`
+}
+
+// JSONCoverageReport writes the given report to w as a JSONCoverageDocument.
+// The coverMode is the -covermode the tests were run with and may be empty.
+func JSONCoverageReport(report *parser.Report, coverMode string, w io.Writer) error {
+	doc := JSONCoverageDocument{Packages: []JSONCoveragePackage{}}
+
+	for _, pkg := range report.Packages {
+		p := JSONCoveragePackage{
+			Name:  pkg.Name,
+			Time:  pkg.Time,
+			Tests: pkg.Tests,
+		}
+		if p.Tests == nil {
+			p.Tests = []*parser.Test{}
+		}
+
+		if pct, ok := pkg.Coverage(); ok {
+			p.Coverage = &JSONCoverage{Percent: pct, Mode: coverMode}
+		}
+
+		doc.Packages = append(doc.Packages, p)
+	}
+
+	bytes, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(w)
+	writer.Write(bytes)
+	writer.WriteByte('\n')
+	return writer.Flush()
+}
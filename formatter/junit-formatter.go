@@ -5,40 +5,69 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"math"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/metacpp/go-junit-report/parser"
 )
 
 // JUnitTestSuites is a collection of JUnit test suites.
 type JUnitTestSuites struct {
-	XMLName xml.Name `xml:"testsuites"`
-	Suites  []JUnitTestSuite
+	XMLName    xml.Name         `xml:"testsuites"`
+	Tests      string           `xml:"tests,attr,omitempty"`
+	Failures   string           `xml:"failures,attr,omitempty"`
+	Errors     string           `xml:"errors,attr,omitempty"`
+	Skipped    string           `xml:"skipped,attr,omitempty"`
+	Time       string           `xml:"time,attr,omitempty"`
+	Properties *JUnitProperties `xml:"properties,omitempty"`
+	Suites     []JUnitTestSuite
 }
 
 // JUnitTestSuite is a single JUnit test suite which may contain many
 // testcases.
 type JUnitTestSuite struct {
-	XMLName    xml.Name        `xml:"testsuite"`
-	Tests      int             `xml:"tests,attr"`
-	Failures   int             `xml:"failures,attr"`
-	Time       string          `xml:"time,attr"`
-	Name       string          `xml:"name,attr"`
-	Properties []JUnitProperty `xml:"properties>property,omitempty"`
-	TestCases  []JUnitTestCase
+	XMLName        xml.Name        `xml:"testsuite"`
+	Tests          int             `xml:"tests,attr"`
+	Failures       int             `xml:"failures,attr"`
+	Errors         int             `xml:"errors,attr,omitempty"`
+	Skipped        int             `xml:"skipped,attr"`
+	Time           string          `xml:"time,attr"`
+	Timestamp      string          `xml:"timestamp,attr,omitempty"`
+	Name           string          `xml:"name,attr"`
+	Hostname       string          `xml:"hostname,attr,omitempty"`
+	Properties     []JUnitProperty `xml:"properties>property,omitempty"`
+	TestCases      []JUnitTestCase
+	SystemOut      string      `xml:"system-out,omitempty"`
+	SystemOutCDATA *JUnitCDATA `xml:",omitempty"`
 }
 
 // JUnitTestCase is a single test case with its result.
 type JUnitTestCase struct {
-	XMLName      xml.Name          `xml:"testcase"`
-	Classname    string            `xml:"classname,attr"`
-	Name         string            `xml:"name,attr"`
-	TotalTime    string            `xml:"time,attr"`
-	CreationTime string            `xml:"creationtime,attr"`
-	DestroyTime  string            `xml:"destroytime,attr"`
-	SkipMessage  *JUnitSkipMessage `xml:"skipped,omitempty"`
-	Failure      *JUnitFailure     `xml:"failure,omitempty"`
+	XMLName        xml.Name          `xml:"testcase"`
+	Classname      string            `xml:"classname,attr"`
+	Name           string            `xml:"name,attr"`
+	TotalTime      string            `xml:"time,attr"`
+	CreationTime   string            `xml:"creationtime,attr"`
+	DestroyTime    string            `xml:"destroytime,attr"`
+	Properties     *JUnitProperties  `xml:"properties,omitempty"`
+	SkipMessage    *JUnitSkipMessage `xml:"skipped,omitempty"`
+	Failure        *JUnitFailure     `xml:"failure,omitempty"`
+	Error          *JUnitFailure     `xml:"error,omitempty"`
+	SystemOut      string            `xml:"system-out,omitempty"`
+	SystemOutCDATA *JUnitCDATA       `xml:",omitempty"`
+	SystemErr      string            `xml:"system-err,omitempty"`
+	SystemErrCDATA *JUnitCDATA       `xml:",omitempty"`
+}
+
+// JUnitCDATA is an element whose contents are written in a CDATA section
+// instead of being escaped, named by XMLName, e.g. system-out.
+type JUnitCDATA struct {
+	XMLName  xml.Name
+	Contents string `xml:",cdata"`
 }
 
 // JUnitSkipMessage contains the reason why a testcase was skipped.
@@ -52,74 +81,326 @@ type JUnitProperty struct {
 	Value string `xml:"value,attr"`
 }
 
-// JUnitFailure contains data related to a failed test.
+// JUnitProperties is a list of properties of a test case or of all test
+// suites.
+type JUnitProperties struct {
+	Properties []JUnitProperty `xml:"property"`
+}
+
+// JUnitFailure contains data related to a failed test, or to a test which
+// ended with an error.
 type JUnitFailure struct {
-	Message  string `xml:"message,attr"`
-	Type     string `xml:"type,attr"`
-	Contents string `xml:",chardata"`
+	Message       string `xml:"message,attr"`
+	Type          string `xml:"type,attr"`
+	Contents      string `xml:",chardata"`
+	ContentsCDATA string `xml:",cdata"`
+}
+
+// TimestampFormat is the format of the timestamp attribute of test suites,
+// ISO 8601 without a timezone.
+const TimestampFormat = "2006-01-02T15:04:05"
+
+// Options contains optional settings which change how JUnitReportXML and
+// JSONReportWithOptions write the report.
+type Options struct {
+	// WrapCDATA writes the output of tests in CDATA sections instead of
+	// escaping it.
+	WrapCDATA bool
+
+	// Timestamp is written as the timestamp of every test suite. It is
+	// omitted when zero.
+	Timestamp time.Time
+
+	// DurationProperty adds a time.ns property to every test case, containing
+	// its duration in nanoseconds without the rounding of the time attribute.
+	DurationProperty bool
+
+	// MaxOutputLines truncates the output of tests written to the report to
+	// its first and last MaxOutputLines lines when greater than zero. The
+	// omitted lines are replaced by a line with their number.
+	MaxOutputLines int
+
+	// ExclusiveTime writes the time of tests without the time of their
+	// subtests, which is included in the time go test reports for them.
+	ExclusiveTime bool
+
+	// TerraformTimings adds the creation and destroy time of Terraform
+	// acceptance tests as tf.creation_time and tf.destroy_time properties of
+	// their test cases, and tf.times_estimated if they are estimates. Zero
+	// times are omitted.
+	TerraformTimings bool
+
+	// Properties are added to the properties of every test suite, after the
+	// go.version property. A property named go.version replaces it.
+	Properties []JUnitProperty
+
+	// SuitesTotals adds the total number of tests, failures, errors and
+	// skipped tests and the total time of all test suites to the testsuites
+	// root element.
+	SuitesTotals bool
+
+	// Hostname is written as the hostname of test suites whose package has
+	// no hostname of its own.
+	Hostname string
+
+	// MaxFailures limits the number of failed test cases written to the
+	// report when greater than zero. The failures attribute of the test
+	// suites still counts all failures, the number of failed test cases left
+	// out of a suite is written to its failures.omitted property.
+	MaxFailures int
+
+	// PackageName is used as the classname of the test cases of packages
+	// without a name, e.g. the output of a compiled test binary.
+	PackageName string
+
+	// JSONIndent indents JSON reports written by JSONReportWithOptions with
+	// two spaces.
+	JSONIndent bool
+
+	// JSONNested writes JSON reports as a JSONNestedDocument, with subtests
+	// nested below their parent test.
+	JSONNested bool
+}
+
+// DefaultGoVersion returns the version of the Go runtime without its go
+// prefix, e.g. 1.21.5, which is written to reports when no Go version is
+// given.
+func DefaultGoVersion() string {
+	return strings.TrimPrefix(runtime.Version(), "go")
 }
 
 // JUnitReportXML writes a JUnit xml representation of the given report to w
 // in the format described at http://windyroad.org/dl/Open%20Source/JUnit.xsd
 func JUnitReportXML(report *parser.Report, noXMLHeader bool, goVersion string, w io.Writer) error {
+	return JUnitReportXMLWithOptions(report, noXMLHeader, goVersion, Options{}, w)
+}
+
+// JUnitReportXMLWithOptions is like JUnitReportXML, but allows changing the
+// written report using opts.
+func JUnitReportXMLWithOptions(report *parser.Report, noXMLHeader bool, goVersion string, opts Options, w io.Writer) error {
 	suites := JUnitTestSuites{}
 
+	// number of failed test cases written so far
+	failures := 0
+
+	if goVersion == "" {
+		// if goVersion was not specified as a flag, fall back to version reported by runtime
+		goVersion = DefaultGoVersion()
+	}
+
+	// properties of every test suite, opts.Properties may override the go
+	// version
+	properties := []JUnitProperty{{"go.version", goVersion}}
+	for _, p := range opts.Properties {
+		replaced := false
+		for i := range properties {
+			if properties[i].Name == p.Name {
+				properties[i].Value = p.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			properties = append(properties, p)
+		}
+	}
+
 	// convert Report to JUnit test suites
 	for _, pkg := range report.Packages {
 		ts := JUnitTestSuite{
-			Tests:      len(pkg.Tests),
+			Tests:      len(pkg.Tests) + len(pkg.Benchmarks),
 			Failures:   0,
-			Time:       formatTime(pkg.Time),
+			Time:       FormatTime(pkg.Time),
 			Name:       pkg.Name,
+			Hostname:   pkg.Hostname,
 			Properties: []JUnitProperty{},
 			TestCases:  []JUnitTestCase{},
+			SystemOut:  strings.Join(truncateOutput(pkg.Setup, opts.MaxOutputLines), "\n"),
+		}
+		if opts.WrapCDATA && ts.SystemOut != "" {
+			ts.SystemOutCDATA = &JUnitCDATA{xml.Name{Local: "system-out"}, ts.SystemOut}
+			ts.SystemOut = ""
+		}
+
+		if !opts.Timestamp.IsZero() {
+			ts.Timestamp = opts.Timestamp.Format(TimestampFormat)
 		}
 
+		// test cases are grouped by the import path of their package
 		classname := pkg.Name
-		if idx := strings.LastIndex(classname, "/"); idx > -1 && idx < len(pkg.Name) {
-			classname = pkg.Name[idx+1:]
+		if classname == "" {
+			classname = opts.PackageName
 		}
 
-		// properties
-		if goVersion == "" {
-			// if goVersion was not specified as a flag, fall back to version reported by runtime
-			goVersion = runtime.Version()
+		if ts.Hostname == "" {
+			ts.Hostname = opts.Hostname
 		}
-		ts.Properties = append(ts.Properties, JUnitProperty{"go.version", goVersion})
+
+		// properties
+		ts.Properties = append(ts.Properties, properties...)
 		if pkg.CoveragePct != "" {
 			ts.Properties = append(ts.Properties, JUnitProperty{"coverage.statements.pct", pkg.CoveragePct})
 		}
 
+		// number of failed test cases left out because of opts.MaxFailures
+		omitted := 0
+
+		// time of the direct subtests of each test
+		subtestsTime := make(map[string]float64)
+		for _, test := range pkg.Tests {
+			if test.Parent != "" {
+				subtestsTime[test.Parent] += test.Time
+			}
+		}
+
 		// individual test cases
 		for _, test := range pkg.Tests {
+			if test.Result == parser.FAIL && !test.TimedOut && test.ErrorKind == "" && opts.MaxFailures > 0 && failures >= opts.MaxFailures {
+				ts.Failures++
+				omitted++
+				continue
+			}
+
+			testTime := test.Time
+			if opts.ExclusiveTime {
+				testTime = math.Max(testTime-subtestsTime[test.Name], 0)
+			}
+
 			testCase := JUnitTestCase{
 				Classname:    classname,
 				Name:         test.Name,
-				TotalTime:    formatTime(test.Time),
-				CreationTime: formatTime(test.CreationTime),
-				DestroyTime:  formatTime(test.DestroyTime),
+				TotalTime:    FormatTime(testTime),
+				CreationTime: FormatTime(test.CreationTime),
+				DestroyTime:  FormatTime(test.DestroyTime),
 				Failure:      nil,
 			}
 
+			// the output of panics and failed builds is written to
+			// system-err, everything else to system-out, or to the failure of
+			// failed tests
+			stdout, stderr := splitOutput(test.Output)
+			if pkg.BuildFailed {
+				stdout, stderr = nil, test.Output
+			}
+			if test.Result == parser.SKIP && test.SkipReason != "" {
+				// the reason is written to the skipped element only
+				stdout = withoutSkipReason(stdout, test.SkipReason)
+			}
+			if test.Result != parser.FAIL {
+				testCase.SystemOut = strings.Join(truncateOutput(stdout, opts.MaxOutputLines), "\n")
+			}
+			testCase.SystemErr = strings.Join(truncateOutput(stderr, opts.MaxOutputLines), "\n")
+			if opts.WrapCDATA {
+				if testCase.SystemOut != "" {
+					testCase.SystemOutCDATA = &JUnitCDATA{xml.Name{Local: "system-out"}, testCase.SystemOut}
+					testCase.SystemOut = ""
+				}
+				if testCase.SystemErr != "" {
+					testCase.SystemErrCDATA = &JUnitCDATA{xml.Name{Local: "system-err"}, testCase.SystemErr}
+					testCase.SystemErr = ""
+				}
+			}
+
+			var properties []JUnitProperty
+			if opts.DurationProperty {
+				ns := test.Duration().Nanoseconds()
+				properties = append(properties, JUnitProperty{"time.ns", strconv.FormatInt(ns, 10)})
+			}
+			if opts.TerraformTimings {
+				properties = append(properties, terraformProperties(test)...)
+			}
+			if test.Slow {
+				properties = append(properties, JUnitProperty{"slow", "true"})
+			}
+			if len(properties) > 0 {
+				testCase.Properties = &JUnitProperties{properties}
+			}
+
 			if test.Result == parser.FAIL {
-				ts.Failures++
-				testCase.Failure = &JUnitFailure{
-					Message:  "Failed",
+				failure := &JUnitFailure{
+					Message:  failureMessage(test.Output),
 					Type:     "",
-					Contents: strings.Join(test.Output, "\n"),
+					Contents: strings.Join(truncateOutput(stdout, opts.MaxOutputLines), "\n"),
+				}
+				if opts.WrapCDATA {
+					failure.Contents, failure.ContentsCDATA = "", failure.Contents
+				}
+
+				if test.Raced {
+					failure.Message = "Data race detected"
+					failure.Type = "race"
+				}
+
+				// tests exceeding the timeout and failures to set up a
+				// package are errors rather than failures
+				if test.TimedOut {
+					ts.Errors++
+					failure.Message = timeoutMessage(test.Output)
+					testCase.Error = failure
+				} else if test.ErrorKind != "" {
+					ts.Errors++
+					failure.Type = test.ErrorKind
+					testCase.Error = failure
+				} else {
+					ts.Failures++
+					failures++
+					testCase.Failure = failure
 				}
 			}
 
 			if test.Result == parser.SKIP {
-				testCase.SkipMessage = &JUnitSkipMessage{strings.Join(test.Output, "\n")}
+				ts.Skipped++
+				message := test.SkipReason
+				if message == "" {
+					message = strings.TrimSpace(strings.Join(truncateOutput(test.Output, opts.MaxOutputLines), "\n"))
+				}
+				testCase.SkipMessage = &JUnitSkipMessage{message}
 			}
 
 			ts.TestCases = append(ts.TestCases, testCase)
 		}
 
+		// benchmarks are reported as passing test cases, with the time of a
+		// single operation as their time
+		for _, benchmark := range pkg.Benchmarks {
+			ts.TestCases = append(ts.TestCases, JUnitTestCase{
+				Classname:    classname,
+				Name:         benchmark.Name,
+				TotalTime:    formatBenchmarkTime(benchmark.NsPerOp),
+				CreationTime: FormatTime(0),
+				DestroyTime:  FormatTime(0),
+			})
+		}
+
+		if omitted > 0 {
+			ts.Properties = append(ts.Properties, JUnitProperty{"failures.omitted", strconv.Itoa(omitted)})
+		}
+
 		suites.Suites = append(suites.Suites, ts)
 	}
 
+	if report.TotalCoverage != "" {
+		suites.Properties = &JUnitProperties{
+			[]JUnitProperty{{"coverage.statements.pct", report.TotalCoverage}},
+		}
+	}
+
+	if opts.SuitesTotals {
+		tests, errors, skipped, time := 0, 0, 0, 0.0
+		for _, ts := range suites.Suites {
+			tests += ts.Tests
+			errors += ts.Errors
+			skipped += ts.Skipped
+		}
+		for _, pkg := range report.Packages {
+			time += pkg.Time
+		}
+		suites.Tests = strconv.Itoa(tests)
+		suites.Failures = strconv.Itoa(report.Failures() - errors)
+		suites.Errors = strconv.Itoa(errors)
+		suites.Skipped = strconv.Itoa(skipped)
+		suites.Time = FormatTime(time)
+	}
+
 	// to xml
 	bytes, err := xml.MarshalIndent(suites, "", "\t")
 	if err != nil {
@@ -134,11 +415,132 @@ func JUnitReportXML(report *parser.Report, noXMLHeader bool, goVersion string, w
 
 	writer.Write(bytes)
 	writer.WriteByte('\n')
-	writer.Flush()
+	return writer.Flush()
+}
+
+// truncateOutput returns the first and last max lines of output, separated
+// by a line with the number of lines omitted in between. The output is
+// returned unchanged if max is zero or it is not longer than 2*max lines.
+func truncateOutput(output []string, max int) []string {
+	if max <= 0 || len(output) <= 2*max {
+		return output
+	}
 
-	return nil
+	truncated := make([]string, 0, 2*max+1)
+	truncated = append(truncated, output[:max]...)
+	truncated = append(truncated, fmt.Sprintf("... (%d lines omitted) ...", len(output)-2*max))
+	return append(truncated, output[len(output)-max:]...)
 }
 
-func formatTime(time float64) string {
-	return fmt.Sprintf("%.3f", float64(time))
+// splitOutput splits the output of a test before the start of a panic, if
+// any.
+func splitOutput(output []string) (stdout, stderr []string) {
+	for i, line := range output {
+		if strings.HasPrefix(line, "panic: ") {
+			return output[:i], output[i:]
+		}
+	}
+	return output, nil
+}
+
+// withoutSkipReason returns output without the last line which is the skip
+// reason of a skipped test.
+func withoutSkipReason(output []string, reason string) []string {
+	for i := len(output) - 1; i >= 0; i-- {
+		if strings.TrimSpace(output[i]) == reason {
+			return append(append(make([]string, 0, len(output)-1), output[:i]...), output[i+1:]...)
+		}
+	}
+	return output
+}
+
+// timeoutMessage returns the message of the panic of a test which exceeded
+// the timeout, e.g. "test timed out after 10m0s".
+func timeoutMessage(output []string) string {
+	for _, line := range output {
+		if strings.HasPrefix(line, "panic: test timed out") {
+			return strings.TrimPrefix(line, "panic: ")
+		}
+	}
+	return "Timed out"
+}
+
+// regexLogEntry matches the start of an entry logged by t.Error or t.Log.
+var regexLogEntry = regexp.MustCompile(`^\S+\.go:\d+:(?: |$)`)
+
+// failureMessage returns the first entry of output joined into a single line.
+// The entry ends at the first blank line or where the next entry starts at
+// the same indent, the continuation lines of a multi-line entry are indented
+// further. The got and want output of failed examples is returned as a whole,
+// one line per line of output. If there is no output "Failed" is returned.
+func failureMessage(output []string) string {
+	// the got and want output of a failed example may contain blank lines,
+	// it is kept as a whole so the message shows the mismatch
+	example := false
+
+	// indent of the first line of the entry
+	indent := ""
+
+	var lines []string
+	for _, line := range output {
+		text := strings.TrimSpace(line)
+		if text == "" {
+			if len(lines) == 0 {
+				continue
+			} else if !example {
+				break
+			}
+		}
+		lineIndent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if len(lines) == 0 {
+			example = text == "got:"
+			indent = lineIndent
+		} else if !example && lineIndent == indent && regexLogEntry.MatchString(text) {
+			break
+		}
+		lines = append(lines, text)
+	}
+
+	if len(lines) == 0 {
+		return "Failed"
+	}
+	if example {
+		return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	}
+	return strings.Join(lines, " ")
+}
+
+// FormatTime formats a duration in seconds with millisecond precision, as
+// used for the time attributes of the JUnit report.
+func FormatTime(time float64) string {
+	return FormatTimePrec(time, 3)
+}
+
+// FormatTimePrec formats a duration in seconds with the given number of
+// decimals. Negative decimals are treated as 0.
+func FormatTimePrec(time float64, decimals int) string {
+	if decimals < 0 {
+		decimals = 0
+	}
+	return strconv.FormatFloat(time, 'f', decimals, 64)
+}
+
+func formatBenchmarkTime(nsPerOp float64) string {
+	return FormatTimePrec(nsPerOp/1e9, 9)
+}
+
+// terraformProperties returns the non-zero Terraform step times of test as
+// properties.
+func terraformProperties(test *parser.Test) []JUnitProperty {
+	var properties []JUnitProperty
+	if test.CreationTime != 0 {
+		properties = append(properties, JUnitProperty{"tf.creation_time", FormatTime(test.CreationTime)})
+	}
+	if test.DestroyTime != 0 {
+		properties = append(properties, JUnitProperty{"tf.destroy_time", FormatTime(test.DestroyTime)})
+	}
+	if len(properties) > 0 && test.TimesEstimated {
+		properties = append(properties, JUnitProperty{"tf.times_estimated", "true"})
+	}
+	return properties
 }
@@ -0,0 +1,104 @@
+package formatter
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/metacpp/go-junit-report/parser"
+)
+
+// Sink receives the packages of a report one at a time, e.g. from
+// parser.ParseStream, and writes them once it is closed or as they arrive.
+type Sink interface {
+	// WritePackage is called with each finished package.
+	WritePackage(pkg parser.Package) error
+
+	// Close is called once all packages were written.
+	Close() error
+}
+
+// ReportSink collects the packages it receives into a report, which is
+// written by a report formatter when the sink is closed.
+type ReportSink struct {
+	Report *parser.Report
+	write  func(report *parser.Report) error
+}
+
+// NewReportSink returns a ReportSink which calls write with the collected
+// report when it is closed, e.g. with a function calling JUnitReportXML.
+func NewReportSink(write func(report *parser.Report) error) *ReportSink {
+	return &ReportSink{
+		Report: &parser.Report{Packages: make([]parser.Package, 0)},
+		write:  write,
+	}
+}
+
+// WritePackage adds pkg to the report.
+func (s *ReportSink) WritePackage(pkg parser.Package) error {
+	s.Report.Packages = append(s.Report.Packages, pkg)
+	return nil
+}
+
+// Close writes the collected report.
+func (s *ReportSink) Close() error {
+	return s.write(s.Report)
+}
+
+// ProgressSink writes a summary line to W for every package it receives, as
+// soon as it receives it.
+type ProgressSink struct {
+	W io.Writer
+}
+
+// WritePackage writes the result, name and test counts of pkg.
+func (s *ProgressSink) WritePackage(pkg parser.Package) error {
+	result := "ok  "
+	failures := 0
+	for _, test := range pkg.Tests {
+		if test.Result == parser.FAIL {
+			failures++
+		}
+	}
+	if failures > 0 {
+		result = "FAIL"
+	}
+
+	_, err := fmt.Fprintf(s.W, "%s %s (%d tests, %d failures)\n", result, pkg.Name, len(pkg.Tests), failures)
+	return err
+}
+
+// Close does nothing, packages are written as they are received.
+func (s *ProgressSink) Close() error {
+	return nil
+}
+
+type multiSink struct {
+	sinks []Sink
+}
+
+// MultiSink returns a sink which writes each package to all of the given
+// sinks, so several reports can be created while parsing the input only
+// once. Writing stops at the first sink returning an error. Closing it closes
+// all sinks and returns the first error.
+func MultiSink(sinks ...Sink) Sink {
+	return &multiSink{append([]Sink{}, sinks...)}
+}
+
+func (m *multiSink) WritePackage(pkg parser.Package) error {
+	for _, s := range m.sinks {
+		if err := s.WritePackage(pkg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *multiSink) Close() error {
+	var err error
+	for _, s := range m.sinks {
+		if cerr := s.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package formatter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/metacpp/go-junit-report/parser"
+)
+
+// TAPReport writes a TAP version 13 representation of the given report to w,
+// as described at https://testanything.org/tap-version-13-specification.html
+func TAPReport(report *parser.Report, w io.Writer) error {
+	writer := bufio.NewWriter(w)
+
+	fmt.Fprintln(writer, "TAP version 13")
+	fmt.Fprintf(writer, "1..%d\n", len(report.AllTests()))
+
+	n := 0
+	for _, pkg := range report.Packages {
+		fmt.Fprintf(writer, "# %s\n", pkg.Name)
+
+		for _, test := range pkg.Tests {
+			n++
+
+			switch test.Result {
+			case parser.PASS:
+				fmt.Fprintf(writer, "ok %d - %s\n", n, test.Name)
+			case parser.SKIP:
+				var reason string
+				if test.SkipReason != "" {
+					reason = " " + test.SkipReason
+				}
+				fmt.Fprintf(writer, "ok %d - %s # SKIP%s\n", n, test.Name, reason)
+			default:
+				fmt.Fprintf(writer, "not ok %d - %s\n", n, test.Name)
+				if len(test.Output) > 0 {
+					// YAML diagnostic block with the test output
+					fmt.Fprintln(writer, "  ---")
+					fmt.Fprintln(writer, "  output: |")
+					for _, line := range test.Output {
+						fmt.Fprintf(writer, "    %s\n", strings.TrimRight(line, " \t"))
+					}
+					fmt.Fprintln(writer, "  ...")
+				}
+			}
+		}
+	}
+
+	return writer.Flush()
+}
@@ -1,9 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/metacpp/go-junit-report/parser"
 	"github.com/metacpp/go-junit-report/formatter"
@@ -14,33 +25,668 @@ var (
 	packageName   string
 	goVersionFlag string
 	setExitCode   bool
+	packagePrefix string
+	minDuration   float64
+	jsonOutput    bool
+	jsonFlat      bool
+	jsonCoverage  bool
+	coverMode     string
+	jsonInput     bool
+	hostnameFlag  string
+	outputFile    string
+	requireTests  bool
+	inputFile     string
+	debug         bool
+	diffBase      string
+	changedOnly   bool
+	wrapCDATA     bool
+	failOnSkip    bool
+	timestamp     string
+	collapseDepth int
+	timeNs        bool
+	format        string
+	goldenFile    string
+	updateGolden  bool
+	envPrefix     string
+	mergePackages bool
+	stripFlag     string
+	maxFailures   int
+	properties    propertyFlags
+	hostname      string
+	creationFlag  string
+	destroyFlag   string
+	logLevelFlag  string
+	suitesRoot    bool
+	serveAddr     string
+	printVersion  bool
+	tfTimings     bool
+	jsonIndent    bool
+	only          string
+	follow        bool
+	followEvery   time.Duration
+	buildFailName string
+	noTestName    string
+	keepColor     bool
+	slowThreshold float64
+	jsonNested    bool
+	strict        bool
+	strictMax     int
+	exclusiveTime bool
+	maxOutput     int
+	minCoverage   float64
+	validate      bool
 )
 
+// version of go-junit-report, set when building releases with
+// -ldflags "-X main.version=..."
+var version = "dev"
+
 func init() {
+	flag.BoolVar(&printVersion, "version", false, "print the version of go-junit-report and exit")
 	flag.BoolVar(&noXMLHeader, "no-xml-header", false, "do not print xml header")
 	flag.StringVar(&packageName, "package-name", "", "specify a package name (compiled test have no package name in output)")
-	flag.StringVar(&goVersionFlag, "go-version", "", "specify the value to use for the go.version property in the generated XML")
-	flag.BoolVar(&setExitCode, "set-exit-code", false, "set exit code to 1 if tests failed")
+	flag.StringVar(&goVersionFlag, "go-version", "", "specify the value to use for the go.version property in the generated XML (defaults to the Go version go-junit-report was built with)")
+	flag.BoolVar(&wrapCDATA, "wrap-cdata", false, "write test output in CDATA sections instead of escaping it")
+	flag.StringVar(&timestamp, "timestamp", "", "specify the timestamp of the test suites as 2006-01-02T15:04:05 (defaults to the current time, or to none with -golden)")
+	flag.Var(&properties, "property", "add a key=value property to every test suite, may be repeated")
+	flag.StringVar(&hostname, "hostname", "", "specify the hostname of the test suites (defaults to the hostname of this machine, or to none with -golden)")
+	flag.StringVar(&envPrefix, "env-property", "", "add the environment variables starting with the given prefix as test suite properties, without the prefix")
+	flag.IntVar(&maxFailures, "max-failures", 0, "only write the first given number of failed test cases to the xml report")
+	flag.BoolVar(&suitesRoot, "testsuites-root", false, "add the total number of tests, failures, errors and skipped tests and the total time to the testsuites root element")
+	flag.IntVar(&maxOutput, "max-output-lines", 0, "only write the first and last given number of lines of the output of each test to the xml report")
+	flag.BoolVar(&exclusiveTime, "exclusive-time", false, "write the time of tests without the time of their subtests")
+	flag.BoolVar(&tfTimings, "tf-timings", false, "add the creation and destroy time of Terraform tests as properties of their test cases")
+	flag.BoolVar(&timeNs, "time-ns", false, "add a time.ns property with the duration in nanoseconds to every test case")
+	flag.BoolVar(&setExitCode, "set-exit-code", false, "set exit code to 1 if tests or builds failed")
+	flag.BoolVar(&failOnSkip, "fail-on-skip", false, "with -set-exit-code, also set exit code to 1 if tests were skipped")
+	flag.BoolVar(&requireTests, "require-tests", false, "with -set-exit-code, also set exit code to 1 if no tests were found")
+	flag.StringVar(&packagePrefix, "package-prefix", "", "strip the given package prefix from each input line (detected automatically if not set)")
+	flag.StringVar(&format, "format", "xml", "specify the report format: xml, json, json-flat, json-coverage, tap, csv, html or flamegraph-json")
+	flag.BoolVar(&jsonInput, "json-input", false, "read the output of go test -json instead of go test -v")
+	flag.BoolVar(&jsonIndent, "json-indent", false, "with -format json, indent the JSON report with two spaces")
+	flag.BoolVar(&jsonNested, "json-nested", false, "with -format json, nest subtests below their parent test")
+	flag.BoolVar(&jsonOutput, "json", false, "write a JSON report instead of JUnit XML (deprecated, use -format json)")
+	flag.BoolVar(&jsonFlat, "json-flat", false, "write the tests of each package as comma separated JSON arrays (deprecated, use -format json)")
+	flag.BoolVar(&jsonCoverage, "json-coverage", false, "write a JSON report with the coverage of each package next to its results (deprecated, use -format json-coverage)")
+	flag.StringVar(&coverMode, "covermode", "", "specify the -covermode the tests were run with, included in the json-coverage report")
+	flag.StringVar(&stripFlag, "strip-output", "", "regular expression matching noise in test output, e.g. from go test -exec wrappers, which is removed from the report")
+	flag.StringVar(&hostnameFlag, "hostname-pattern", "", "regular expression matching log lines that mark the node a package runs on, its first group is used as hostname")
+	flag.StringVar(&buildFailName, "build-failure-name", "", "name of the test case added to packages whose build failed, {package} is replaced by the package name (default the build result, e.g. [build failed])")
+	flag.StringVar(&noTestName, "no-test-failure-name", "", "name of the test case added to packages which failed without running tests, {package} is replaced by the package name (default Failure)")
+	flag.BoolVar(&keepColor, "keep-color", false, "keep ANSI escape sequences, e.g. colors, in the test output of the report")
+	flag.BoolVar(&validate, "validate", false, "only parse the input and print the number of recognized and unrecognized lines to standard error, without writing a report")
+	flag.BoolVar(&strict, "strict", false, "fail if lines of the input were not recognized as go test output, e.g. because its format changed")
+	flag.IntVar(&strictMax, "strict-max", 0, "with -strict, the number of unrecognized lines which are allowed")
+	flag.BoolVar(&mergePackages, "merge-packages", false, "combine packages with the same name, keeping the last result of tests that were run more than once")
+	flag.StringVar(&creationFlag, "creation-pattern", "", "regular expression matching the log line that starts the creation step of a Terraform test, its first group is the time of the line")
+	flag.StringVar(&destroyFlag, "destroy-pattern", "", "regular expression matching the log line that starts the destroy step of a Terraform test, its first group is the time of the line")
+	flag.StringVar(&logLevelFlag, "log-level-pattern", "", "regular expression matching the log level of the Terraform log lines that start the creation and destroy steps, e.g. level=\\w+ for structured logs")
+	flag.StringVar(&serveAddr, "serve", "", "listen on the given address, e.g. :8080, and respond to go test output posted to it with a report in the format selected by the Accept header")
+	flag.BoolVar(&follow, "follow", false, "while reading the input, periodically replace the -output file with a report of the packages finished so far")
+	flag.DurationVar(&followEvery, "follow-interval", 10*time.Second, "with -follow, the interval between partial reports")
+	flag.StringVar(&inputFile, "input", "", "read the go test output from the given file instead of standard in")
+	flag.StringVar(&outputFile, "output", "", "write the report to the given file instead of standard out")
+	flag.IntVar(&collapseDepth, "collapse-packages", 0, "merge packages sharing the given number of leading import path elements into a single test suite")
+	flag.StringVar(&only, "only", "all", "only report tests with the given result: failures, skips or all")
+	flag.Float64Var(&minDuration, "min-duration", 0, "only report tests that took at least the given number of seconds")
+	flag.Float64Var(&minCoverage, "min-coverage", 0, "set exit code to 1 if the coverage of any package or the total coverage is below the given percentage")
+	flag.Float64Var(&slowThreshold, "slow-threshold", 0, "mark tests that took longer than the given number of seconds as slow")
+	flag.StringVar(&diffBase, "diff", "", "compare the results against the given json or json-coverage report and set exit code to 1 on new failures")
+	flag.BoolVar(&changedOnly, "changed-only", false, "with -diff, only report tests whose result changed compared to the base report")
+	flag.StringVar(&goldenFile, "golden", "", "compare the report with the given golden file and set exit code to 1 if they differ")
+	flag.BoolVar(&updateGolden, "update", false, "with -golden, replace the golden file with the report instead of comparing them")
+	flag.BoolVar(&debug, "debug", false, "write parser debug output to standard error")
 }
 
 func main() {
+	start := time.Now()
+
 	flag.Parse()
 
-	// Read input
-	report, err := parser.Parse(os.Stdin, packageName)
+	if printVersion {
+		fmt.Println(versionString())
+		os.Exit(0)
+	}
+
+	if goVersionFlag == "" {
+		goVersionFlag = formatter.DefaultGoVersion()
+	}
+
+	var err error
+
+	format, err = outputFormat(format, jsonOutput, jsonFlat, jsonCoverage)
 	if err != nil {
-		fmt.Printf("Error reading input: %s\n", err)
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(2)
+	}
+
+	keep, err := resultFilter(only)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(2)
+	}
+
+	if validate && jsonInput {
+		fmt.Fprintf(os.Stderr, "-validate can't be used with -json-input\n")
+		os.Exit(2)
+	}
+
+	if serveAddr != "" && (diffBase != "" || follow || goldenFile != "" || validate) {
+		fmt.Fprintf(os.Stderr, "-serve can't be used with -diff, -follow, -golden or -validate\n")
+		os.Exit(2)
+	}
+
+	if follow && (outputFile == "" || jsonInput) {
+		fmt.Fprintf(os.Stderr, "-follow requires -output and can't be used with -json-input\n")
+		os.Exit(2)
+	}
+
+	if debug {
+		parser.Console.Target = os.Stderr
+	}
+
+	// the current time and hostname would never match a golden file, they
+	// are only written to it if given explicitly
+	if hostname == "" && goldenFile == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	if timestamp != "" {
+		start, err = time.Parse(formatter.TimestampFormat, timestamp)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing -timestamp: %s\n", err)
+			os.Exit(1)
+		}
+	} else if goldenFile != "" {
+		start = time.Time{}
+	}
+
+	var hostnamePattern *regexp.Regexp
+	if hostnameFlag != "" {
+		hostnamePattern, err = regexp.Compile(hostnameFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing -hostname-pattern: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var creationPattern, destroyPattern *regexp.Regexp
+	if creationFlag != "" {
+		creationPattern, err = regexp.Compile(creationFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing -creation-pattern: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if destroyFlag != "" {
+		destroyPattern, err = regexp.Compile(destroyFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing -destroy-pattern: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var logLevelPattern *regexp.Regexp
+	if logLevelFlag != "" {
+		logLevelPattern, err = regexp.Compile(logLevelFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing -log-level-pattern: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var stripPattern *regexp.Regexp
+	if stripFlag != "" {
+		stripPattern, err = regexp.Compile(stripFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing -strip-output: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	parseOpts := parser.Options{
+		PackagePrefix:        packagePrefix,
+		HostnamePattern:      hostnamePattern,
+		StripOutput:          stripPattern,
+		CreationStartPattern: creationPattern,
+		DestroyStartPattern:  destroyPattern,
+		LogLevelPattern:      logLevelPattern,
+		BuildFailureName:     buildFailName,
+		NoTestFailureName:    noTestName,
+		MergePackages:        mergePackages,
+		KeepColor:            keepColor,
+		Strict:               strict,
+		MaxUnrecognized:      strictMax,
+	}
+
+	xmlOpts := formatter.Options{
+		WrapCDATA:        wrapCDATA,
+		DurationProperty: timeNs,
+		TerraformTimings: tfTimings,
+		ExclusiveTime:    exclusiveTime,
+		MaxOutputLines:   maxOutput,
+		Properties:       append(properties, envProperties(envPrefix, os.Environ())...),
+		Hostname:         hostname,
+		MaxFailures:      maxFailures,
+		SuitesTotals:     suitesRoot,
+		PackageName:      packageName,
+	}
+
+	// readReport reads the report of the go test output read from r
+	readReport := func(r io.Reader) (*parser.Report, error) {
+		if jsonInput {
+			return parser.ParseJSON(r, packageName)
+		}
+		return parser.ParseWithOptions(r, packageName, parseOpts)
+	}
+
+	if serveAddr != "" {
+		// the report of each request gets the time it was received as
+		// timestamp, unless a timestamp was given
+		if timestamp != "" {
+			xmlOpts.Timestamp = start
+		}
+		read := func(r io.Reader) (*parser.Report, error) {
+			report, err := readReport(r)
+			if err != nil {
+				return nil, err
+			}
+			return outputReport(report, nil, keep), nil
+		}
+		fmt.Fprintf(os.Stderr, "Listening on %s\n", serveAddr)
+		err = http.ListenAndServe(serveAddr, reportHandler(read, goVersionFlag, xmlOpts))
+		fmt.Fprintf(os.Stderr, "Error serving: %s\n", err)
 		os.Exit(1)
 	}
+	xmlOpts.Timestamp = start
+
+	var base *parser.Report
+	if diffBase != "" {
+		base, err = readJSONReport(diffBase)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading diff base: %s\n", err)
+			os.Exit(1)
+		}
+	}
 
-	// Write xml
-	err = formatter.JUnitReportXML(report, noXMLHeader, goVersionFlag, os.Stdout)
+	// write partial reports while parsing, the complete report is written
+	// once the input has been read like without -follow
+	var stopFollow chan struct{}
+	var followDone <-chan struct{}
+	if follow {
+		f := &follower{}
+		parseOpts.Progress = f.add
+		stopFollow = make(chan struct{})
+		followDone = f.follow(followEvery, func(partial *parser.Report) error {
+			return writeFile(outputFile, func(w io.Writer) error {
+				return writeReport(outputReport(partial, base, keep), xmlOpts, w)
+			})
+		}, stopFollow)
+	}
+
+	r := os.Stdin
+	if inputFile != "" {
+		r, err = os.Open(inputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening input file: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var stats parser.Stats
+	if validate {
+		parseOpts.Stats = &stats
+	}
+
+	// Read input
+	report, err := readReport(r)
+	if inputFile != "" {
+		r.Close()
+	}
+	if follow {
+		close(stopFollow)
+		<-followDone
+	}
+	if validate {
+		printStats(os.Stderr, stats)
+	}
 	if err != nil {
-		fmt.Printf("Error writing XML: %s\n", err)
+		fmt.Fprintf(os.Stderr, "Error reading input: %s\n", err)
 		os.Exit(1)
 	}
+	if validate {
+		os.Exit(0)
+	}
+
+	// only the written report is filtered, failures of fast tests should
+	// still be reflected in the exit code
+	output := outputReport(report, base, keep)
+
+	w := os.Stdout
+	if outputFile != "" {
+		w, err = os.Create(outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output file: %s\n", err)
+			os.Exit(1)
+		}
+	}
 
-	if setExitCode && report.Failures() > 0 {
+	var out io.Writer = w
+	var generated bytes.Buffer
+	if goldenFile != "" {
+		out = io.MultiWriter(w, &generated)
+	}
+
+	if err = writeReport(output, xmlOpts, out); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
+
+	if outputFile != "" {
+		if err = w.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output file: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if goldenFile != "" {
+		checkGolden(goldenFile, generated.Bytes(), updateGolden)
+	}
+
+	code := exitCode(report, setExitCode, requireTests, failOnSkip)
+
+	if minCoverage > 0 {
+		for _, msg := range lowCoverage(report, minCoverage) {
+			fmt.Fprintf(os.Stderr, "%s\n", msg)
+			code = 1
+		}
+	}
+
+	if base != nil {
+		diff := parser.Diff(base, report)
+		for _, id := range diff.NewFailures {
+			fmt.Fprintf(os.Stderr, "New failure: %s %s\n", id.Package, id.Name)
+		}
+		if len(diff.NewFailures) > 0 {
+			code = 1
+		}
+	}
+
+	os.Exit(code)
+}
+
+// outputReport returns the report to write, with the packages collapsed and
+// the tests filtered as selected by the flags.
+func outputReport(report, base *parser.Report, keep func(*parser.Test) bool) *parser.Report {
+	output := report
+	if collapseDepth > 0 {
+		output = output.CollapsePackages(collapseDepth)
+	}
+	if minDuration > 0 {
+		output = output.FilterByDuration(minDuration)
+	}
+	if keep != nil {
+		output = output.Filter(keep)
+	}
+	if base != nil && changedOnly {
+		output = parser.FilterChanged(base, output)
+	}
+	if slowThreshold > 0 {
+		output.MarkSlow(slowThreshold)
+	}
+	return output
+}
+
+// writeReport writes report to w in the format selected by the -format flag.
+func writeReport(report *parser.Report, xmlOpts formatter.Options, w io.Writer) error {
+	switch format {
+	case "tap":
+		if err := formatter.TAPReport(report, w); err != nil {
+			return fmt.Errorf("Error writing TAP: %s", err)
+		}
+	case "csv":
+		if err := formatter.CSVReport(report, w); err != nil {
+			return fmt.Errorf("Error writing CSV: %s", err)
+		}
+	case "html":
+		if err := formatter.HTMLReport(report, w); err != nil {
+			return fmt.Errorf("Error writing HTML: %s", err)
+		}
+	case "flamegraph-json":
+		if err := formatter.FlameGraphReport(report, w); err != nil {
+			return fmt.Errorf("Error writing JSON: %s", err)
+		}
+	case "json-coverage":
+		if err := formatter.JSONCoverageReport(report, coverMode, w); err != nil {
+			return fmt.Errorf("Error writing JSON: %s", err)
+		}
+	case "json-flat":
+		if err := formatter.JSONFlatReport(report, w); err != nil {
+			return fmt.Errorf("Error writing JSON: %s", err)
+		}
+	case "json":
+		xmlOpts.JSONIndent = jsonIndent
+		xmlOpts.JSONNested = jsonNested
+		if err := formatter.JSONReportWithOptions(report, goVersionFlag, xmlOpts, w); err != nil {
+			return fmt.Errorf("Error writing JSON: %s", err)
+		}
+	default:
+		if err := formatter.JUnitReportXMLWithOptions(report, noXMLHeader, goVersionFlag, xmlOpts, w); err != nil {
+			return fmt.Errorf("Error writing XML: %s", err)
+		}
+	}
+	return nil
+}
+
+// versionString returns the version of go-junit-report and the Go version it
+// was built with.
+func versionString() string {
+	return fmt.Sprintf("go-junit-report %s %s", version, runtime.Version())
+}
+
+// formats lists the values accepted by the -format flag.
+var formats = []string{"xml", "json", "json-flat", "json-coverage", "tap", "csv", "html", "flamegraph-json"}
+
+// outputFormat returns the report format selected by the -format flag, or by
+// the deprecated -json, -json-flat and -json-coverage flags if -format was
+// left at its default.
+func outputFormat(format string, jsonOutput, jsonFlat, jsonCoverage bool) (string, error) {
+	if format == "xml" {
+		switch {
+		case jsonCoverage:
+			format = "json-coverage"
+		case jsonFlat:
+			format = "json-flat"
+		case jsonOutput:
+			format = "json"
+		}
+	}
+
+	for _, f := range formats {
+		if f == format {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("Unsupported -format %q, must be one of %s", format, strings.Join(formats, ", "))
+}
+
+// propertyFlags collects the properties given by repeated -property flags.
+type propertyFlags []formatter.JUnitProperty
+
+func (p *propertyFlags) String() string {
+	var s []string
+	for _, property := range *p {
+		s = append(s, property.Name+"="+property.Value)
+	}
+	return strings.Join(s, ",")
+}
+
+// Set adds a property given as key=value.
+func (p *propertyFlags) Set(value string) error {
+	idx := strings.Index(value, "=")
+	if idx < 1 {
+		return fmt.Errorf("property %q is not of the form key=value", value)
+	}
+	*p = append(*p, formatter.JUnitProperty{Name: value[:idx], Value: value[idx+1:]})
+	return nil
+}
+
+// envProperties returns a property for each variable in environ, in the
+// "key=value" form of os.Environ, whose key starts with prefix. The prefix is
+// removed from the property names and control characters, which are not
+// allowed in XML, are removed from the values. No properties are returned if
+// prefix is empty.
+func envProperties(prefix string, environ []string) []formatter.JUnitProperty {
+	if prefix == "" {
+		return nil
+	}
+
+	var properties []formatter.JUnitProperty
+	for _, env := range environ {
+		idx := strings.Index(env, "=")
+		if idx < 0 || !strings.HasPrefix(env[:idx], prefix) || idx == len(prefix) {
+			continue
+		}
+
+		value := strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r' {
+				return -1
+			}
+			return r
+		}, env[idx+1:])
+		properties = append(properties, formatter.JUnitProperty{Name: env[len(prefix):idx], Value: value})
+	}
+
+	sort.Slice(properties, func(i, j int) bool {
+		return properties[i].Name < properties[j].Name
+	})
+	return properties
+}
+
+// resultFilter returns a function keeping the tests with the result selected
+// by the -only flag, or nil if all tests should be kept.
+func resultFilter(only string) (func(*parser.Test) bool, error) {
+	switch only {
+	case "all":
+		return nil, nil
+	case "failures":
+		return func(t *parser.Test) bool { return t.Result == parser.FAIL }, nil
+	case "skips":
+		return func(t *parser.Test) bool { return t.Result == parser.SKIP }, nil
+	default:
+		return nil, fmt.Errorf("Unsupported -only %q, must be one of failures, skips, all", only)
+	}
+}
+
+// jsonReport is a report written with -format json, with or without
+// -json-nested, or with -format json-coverage.
+type jsonReport struct {
+	TotalCoverage string `json:"totalCoverage"`
+	Packages      []struct {
+		parser.Package
+		Tests    []*jsonTest             `json:"tests"`
+		Coverage *formatter.JSONCoverage `json:"coverage"`
+	} `json:"packages"`
+}
+
+// jsonTest is a test of a jsonReport, with its subtests if they are nested.
+type jsonTest struct {
+	parser.Test
+	Subtests []*jsonTest `json:"subtests"`
+}
+
+// flatten appends the test and all of its subtests to tests.
+func (t *jsonTest) flatten(tests []*parser.Test) []*parser.Test {
+	test := t.Test
+	tests = append(tests, &test)
+	for _, subtest := range t.Subtests {
+		tests = subtest.flatten(tests)
+	}
+	return tests
+}
+
+// readJSONReport reads a report written by formatter.JSONReport, with nested
+// subtests or by formatter.JSONCoverageReport from the file with the given
+// name.
+func readJSONReport(name string) (*parser.Report, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var doc jsonReport
+	if err := json.NewDecoder(f).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	report := &parser.Report{Packages: make([]parser.Package, 0, len(doc.Packages)), TotalCoverage: doc.TotalCoverage}
+	for _, p := range doc.Packages {
+		pkg := p.Package
+		pkg.Tests = make([]*parser.Test, 0, len(p.Tests))
+		for _, test := range p.Tests {
+			pkg.Tests = test.flatten(pkg.Tests)
+		}
+		if pkg.CoveragePct == "" && p.Coverage != nil {
+			pkg.CoveragePct = strconv.FormatFloat(p.Coverage.Percent, 'f', 1, 64)
+		}
+		report.Packages = append(report.Packages, pkg)
+	}
+	return report, nil
+}
+
+// printStats writes the number of lines of each kind and the first
+// unrecognized lines to w, for -validate.
+func printStats(w io.Writer, stats parser.Stats) {
+	fmt.Fprintf(w, "Lines:                %d\n", stats.Lines)
+	fmt.Fprintf(w, "Package result lines: %d\n", stats.Results)
+	fmt.Fprintf(w, "Test status lines:    %d\n", stats.Statuses)
+	fmt.Fprintf(w, "Coverage lines:       %d\n", stats.Coverage)
+	fmt.Fprintf(w, "Unrecognized lines:   %d\n", stats.Unrecognized)
+	for _, l := range stats.UnrecognizedLines {
+		fmt.Fprintf(w, "  line %d: %s\n", l.Number, l.Text)
+	}
+	if stats.Unrecognized > len(stats.UnrecognizedLines) {
+		fmt.Fprintf(w, "  ...\n")
+	}
+}
+
+// lowCoverage returns a message for each package of report whose coverage is
+// below min, and for the total coverage if it is. Packages without coverage
+// are ignored.
+func lowCoverage(report *parser.Report, min float64) []string {
+	var msgs []string
+	for _, pkg := range report.Packages {
+		if pct, ok := pkg.Coverage(); ok && pct < min {
+			msgs = append(msgs, fmt.Sprintf("Coverage of %s is %s%%, below %g%%", pkg.Name, pkg.CoveragePct, min))
+		}
+	}
+	if pct, ok := report.Coverage(); ok && pct < min {
+		msgs = append(msgs, fmt.Sprintf("Total coverage is %s%%, below %g%%", report.TotalCoverage, min))
+	}
+	return msgs
+}
+
+// exitCode returns the exit code for the given report. Without setExitCode
+// the exit code is always 0. Otherwise it is 1 if any test failed, if
+// failOnSkip is set and any test was skipped, or if requireTests is set and
+// the report contains no tests at all.
+func exitCode(report *parser.Report, setExitCode, requireTests, failOnSkip bool) int {
+	if !setExitCode {
+		return 0
+	}
+
+	if !report.Success() {
+		return 1
+	}
+
+	if failOnSkip && report.Skipped() > 0 {
+		return 1
+	}
+
+	if requireTests && report.Total() == 0 {
+		return 1
+	}
+
+	return 0
 }
@@ -2,12 +2,20 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
+	"regexp"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/metacpp/go-junit-report/formatter"
 	"github.com/metacpp/go-junit-report/parser"
@@ -19,6 +27,8 @@ type TestCase struct {
 	report      *parser.Report
 	noXMLHeader bool
 	packageName string
+	jsonInput   bool
+	options     parser.Options
 }
 
 var testCases = []TestCase{
@@ -89,9 +99,10 @@ var testCases = []TestCase{
 					Time: 150,
 					Tests: []*parser.Test{
 						{
-							Name:   "TestOne",
-							Time:   20,
-							Result: parser.SKIP,
+							Name:       "TestOne",
+							Time:       20,
+							Result:     parser.SKIP,
+							SkipReason: "file_test.go:11: Skip message",
 							Output: []string{
 								"file_test.go:11: Skip message",
 							},
@@ -373,18 +384,21 @@ var testCases = []TestCase{
 						},
 						{
 							Name:   "TestOne/Child",
+							Parent: "TestOne",
 							Time:   20,
 							Result: parser.PASS,
 							Output: []string{},
 						},
 						{
 							Name:   "TestOne/Child#01",
+							Parent: "TestOne",
 							Time:   30,
 							Result: parser.PASS,
 							Output: []string{},
 						},
 						{
 							Name:   "TestOne/Child=02",
+							Parent: "TestOne",
 							Time:   40,
 							Result: parser.PASS,
 							Output: []string{},
@@ -397,18 +411,21 @@ var testCases = []TestCase{
 						},
 						{
 							Name:   "TestTwo/Child",
+							Parent: "TestTwo",
 							Time:   20,
 							Result: parser.PASS,
 							Output: []string{},
 						},
 						{
 							Name:   "TestTwo/Child#01",
+							Parent: "TestTwo",
 							Time:   30,
 							Result: parser.PASS,
 							Output: []string{},
 						},
 						{
 							Name:   "TestTwo/Child=02",
+							Parent: "TestTwo",
 							Time:   40,
 							Result: parser.PASS,
 							Output: []string{},
@@ -421,18 +438,21 @@ var testCases = []TestCase{
 						},
 						{
 							Name:   "TestThree/a#1",
+							Parent: "TestThree",
 							Time:   20,
 							Result: parser.PASS,
 							Output: []string{},
 						},
 						{
 							Name:   "TestThree/a#1/b#1",
+							Parent: "TestThree/a#1",
 							Time:   30,
 							Result: parser.PASS,
 							Output: []string{},
 						},
 						{
 							Name:   "TestThree/a#1/b#1/c#1",
+							Parent: "TestThree/a#1/b#1",
 							Time:   40,
 							Result: parser.PASS,
 							Output: []string{},
@@ -445,6 +465,7 @@ var testCases = []TestCase{
 						},
 						{
 							Name:   "TestFour/#00",
+							Parent: "TestFour",
 							Time:   0,
 							Result: parser.FAIL,
 							Output: []string{
@@ -454,23 +475,27 @@ var testCases = []TestCase{
 							},
 						},
 						{
-							Name:   "TestFour/#01",
-							Time:   0,
-							Result: parser.SKIP,
+							Name:       "TestFour/#01",
+							Parent:     "TestFour",
+							Time:       0,
+							Result:     parser.SKIP,
+							SkipReason: "example.go:1234: Not supported yet.",
 							Output: []string{
 								"example.go:1234: Not supported yet.",
 							},
 						},
 						{
 							Name:   "TestFour/#02",
+							Parent: "TestFour",
 							Time:   0,
 							Result: parser.PASS,
 							Output: []string{},
 						},
 						{
-							Name:   "TestFive",
-							Time:   0,
-							Result: parser.SKIP,
+							Name:       "TestFive",
+							Time:       0,
+							Result:     parser.SKIP,
+							SkipReason: "example.go:1392: Not supported yet.",
 							Output: []string{
 								"example.go:1392: Not supported yet.",
 							},
@@ -518,7 +543,8 @@ var testCases = []TestCase{
 					},
 				},
 				{
-					Name: "package/name/failing1",
+					Name:        "package/name/failing1",
+					BuildFailed: true,
 					Tests: []*parser.Test{
 						{
 							Name:   "[build failed]",
@@ -531,7 +557,8 @@ var testCases = []TestCase{
 					},
 				},
 				{
-					Name: "package/name/failing2",
+					Name:        "package/name/failing2",
+					BuildFailed: true,
 					Tests: []*parser.Test{
 						{
 							Name:   "[build failed]",
@@ -544,7 +571,8 @@ var testCases = []TestCase{
 					},
 				},
 				{
-					Name: "package/name/setupfailing1",
+					Name:        "package/name/setupfailing1",
+					BuildFailed: true,
 					Tests: []*parser.Test{
 						{
 							Name:   "[setup failed]",
@@ -578,6 +606,7 @@ var testCases = []TestCase{
 								"panic: init",
 								"stacktrace",
 							},
+							ErrorKind: parser.ErrorSetup,
 						},
 					},
 				},
@@ -592,6 +621,7 @@ var testCases = []TestCase{
 								"panic: init",
 								"stacktrace",
 							},
+							ErrorKind: parser.ErrorSetup,
 						},
 					},
 				},
@@ -604,9 +634,10 @@ var testCases = []TestCase{
 		report: &parser.Report{
 			Packages: []parser.Package{
 				{
-					Name:  "package/empty",
-					Time:  1,
-					Tests: []*parser.Test{},
+					Name:    "package/empty",
+					Time:    1,
+					Tests:   []*parser.Test{},
+					NoTests: true,
 				},
 			},
 		},
@@ -625,18 +656,12 @@ var testCases = []TestCase{
 							Time:   0,
 							Result: parser.PASS,
 							Output: []string{},
-						},
-						{
-							Name:   "TestRepeat",
-							Time:   0,
-							Result: parser.PASS,
-							Output: []string{},
-						},
-						{
-							Name:   "TestRepeat",
-							Time:   0,
-							Result: parser.PASS,
-							Output: []string{},
+							Runs:   []parser.Result{parser.PASS, parser.PASS, parser.PASS},
+							RunOutput: [][]string{
+								{},
+								{},
+								{},
+							},
 						},
 					},
 				},
@@ -656,6 +681,7 @@ var testCases = []TestCase{
 							Name:   "TestRace",
 							Time:   0,
 							Result: parser.FAIL,
+							Raced:  true,
 							Output: []string{
 								"test output",
 								"2 0xc4200153d0",
@@ -739,114 +765,4198 @@ var testCases = []TestCase{
 			},
 		},
 	},
-}
-
-func TestParser(t *testing.T) {
-	for _, testCase := range testCases {
-		t.Logf("Running: %s", testCase.name)
-
-		file, err := os.Open("tests/" + testCase.name)
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		report, err := parser.Parse(file, testCase.packageName)
-		if err != nil {
-			t.Fatalf("error parsing: %s", err)
-		}
-
-		if report == nil {
-			t.Fatalf("Report == nil")
-		}
-
-		expected := testCase.report
-		if len(report.Packages) != len(expected.Packages) {
-			t.Fatalf("Report packages == %d, want %d", len(report.Packages), len(expected.Packages))
-		}
-
-		for i, pkg := range report.Packages {
-			expPkg := expected.Packages[i]
-
-			if pkg.Name != expPkg.Name {
-				t.Errorf("Package.Name == %s, want %s", pkg.Name, expPkg.Name)
-			}
-
-			if pkg.Time != expPkg.Time {
-				t.Errorf("Package.Time == %d, want %d", pkg.Time, expPkg.Time)
-			}
-
-			if len(pkg.Tests) != len(expPkg.Tests) {
-				t.Fatalf("Package Tests == %d, want %d", len(pkg.Tests), len(expPkg.Tests))
-			}
-
-			for j, test := range pkg.Tests {
-				expTest := expPkg.Tests[j]
-
-				if test.Name != expTest.Name {
-					t.Errorf("Test.Name == %s, want %s", test.Name, expTest.Name)
-				}
-
-				if test.Time != expTest.Time {
-					t.Errorf("Test.Time == %d, want %d", test.Time, expTest.Time)
-				}
-
-				if test.Result != expTest.Result {
-					t.Errorf("Test.Result == %d, want %d", test.Result, expTest.Result)
-				}
-
-				testOutput := strings.Join(test.Output, "\n")
-				expTestOutput := strings.Join(expTest.Output, "\n")
-				if testOutput != expTestOutput {
-					t.Errorf("Test.Output (%s) ==\n%s\n, want\n%s", test.Name, testOutput, expTestOutput)
-				}
-			}
-			if pkg.CoveragePct != expPkg.CoveragePct {
-				t.Errorf("Package.CoveragePct == %s, want %s", pkg.CoveragePct, expPkg.CoveragePct)
-			}
-		}
-	}
-}
-
-func TestJUnitFormatter(t *testing.T) {
-	testJUnitFormatter(t, "")
-}
-
-func TestVersionFlag(t *testing.T) {
-	testJUnitFormatter(t, "custom-version")
-}
-
-func testJUnitFormatter(t *testing.T, goVersion string) {
-	for _, testCase := range testCases {
-		report, err := loadTestReport(testCase.reportName, goVersion)
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		var junitReport bytes.Buffer
-
-		if err = formatter.JUnitReportXML(testCase.report, testCase.noXMLHeader, goVersion, &junitReport); err != nil {
-			t.Fatal(err)
-		}
-
-		if string(junitReport.Bytes()) != report {
-			t.Fatalf("Fail: %s Report xml ==\n%s, want\n%s", testCase.name, string(junitReport.Bytes()), report)
-		}
-	}
-}
-
-func loadTestReport(name, goVersion string) (string, error) {
-	contents, err := ioutil.ReadFile("tests/" + name)
-	if err != nil {
-		return "", err
-	}
-
-	if goVersion == "" {
-		// if goVersion is not specified, default to runtime version
-		goVersion = runtime.Version()
-	}
-
-	// replace value="1.0" With actual version
-	report := strings.Replace(string(contents), `value="1.0"`, fmt.Sprintf(`value="%s"`, goVersion), -1)
-
-	return report, nil
+	{
+		name:       "19-package-prefix.txt",
+		reportName: "19-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/prefixed",
+					Time: 0.151,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOne",
+							Time:   0.02,
+							Result: parser.PASS,
+							Output: []string{
+								"file_test.go:11: some output",
+							},
+						},
+						{
+							Name:   "TestTwo",
+							Time:   0.13,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "20-build-warnings.txt",
+		reportName: "20-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/name",
+					Time: 0.16,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOne",
+							Time:   0.06,
+							Result: parser.PASS,
+							Output: []string{
+								"file_test.go:11: output of TestOne",
+							},
+						},
+						{
+							Name:   "TestTwo",
+							Time:   0.1,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "21-json.txt",
+		reportName: "21-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/name",
+					Time: 0.16,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOne",
+							Time:   0.02,
+							Result: parser.FAIL,
+							Output: []string{
+								"file_test.go:11: Error message",
+							},
+						},
+						{
+							Name:   "TestTwo",
+							Time:   0.01,
+							Result: parser.SKIP,
+							Output: []string{
+								"file_test.go:26: Skip message",
+							},
+							SkipReason: "file_test.go:26: Skip message",
+						},
+						{
+							Name:   "TestThree",
+							Time:   0.13,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+					CoveragePct: "13.37",
+				},
+			},
+		},
+		jsonInput: true,
+	},
+	{
+		name:       "22-bench.txt",
+		reportName: "22-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name:  "package/basic",
+					Time:  3.212,
+					Tests: []*parser.Test{},
+					Benchmarks: []*parser.Benchmark{
+						{
+							Name:       "BenchmarkParse",
+							Iterations: 2000000,
+							NsPerOp:    604,
+						},
+						{
+							Name:        "BenchmarkReadingList",
+							Iterations:  1000000,
+							NsPerOp:     1425,
+							BytesPerOp:  368,
+							AllocsPerOp: 4,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "23-empty-subtest.txt",
+		reportName: "23-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/name",
+					Time: 0.05,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestEmpty",
+							Time:   0.03,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestEmpty/",
+							Parent: "TestEmpty",
+							Time:   0.02,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestEmpty//",
+							Parent: "TestEmpty/",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{
+								"file_test.go:12: nested output",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "24-hostname.txt",
+		reportName: "24-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name:     "package/one",
+					Time:     0.02,
+					Hostname: "worker-1",
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOne",
+							Time:   0.02,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+				{
+					Name:     "package/two",
+					Time:     0.03,
+					Hostname: "worker-2",
+					Tests: []*parser.Test{
+						{
+							Name:   "TestTwo",
+							Time:   0.03,
+							Result: parser.FAIL,
+							Output: []string{
+								"file_test.go:11: failed on worker-2",
+							},
+						},
+					},
+				},
+			},
+		},
+		options: parser.Options{
+			HostnamePattern: regexp.MustCompile(`^=== NODE (\S+)$`),
+		},
+	},
+	{
+		name:       "25-multiline-errorf.txt",
+		reportName: "25-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/name",
+					Time: 0.01,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestErrorf",
+							Time:   0.01,
+							Result: parser.FAIL,
+							Output: []string{
+								"file_test.go:14: unexpected result:",
+								"\tgot:  1",
+								"\twant: 2",
+								"",
+								"file_test.go:20: second error",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "26-coverprofile.txt",
+		reportName: "26-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/coverprofile",
+					Time: 0.3,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestA",
+							Time:   0.1,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestB",
+							Time:   0.2,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+					CoveragePct: "87.5",
+				},
+			},
+		},
+	},
+	{
+		name:       "27-panic-in-test.txt",
+		reportName: "27-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/name",
+					Time: 0.012,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOne",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestPanic",
+							Time:   0,
+							Result: parser.FAIL,
+							Output: []string{
+								"panic: runtime error: index out of range [recovered]",
+								"\tpanic: runtime error: index out of range",
+								"",
+								"goroutine 6 [running]:",
+								"testing.tRunner.func1(0xc4200c8000)",
+								"\t/usr/local/go/src/testing/testing.go:742 +0x29d",
+								"package/name.TestPanic(0xc4200c8000)",
+								"\t/src/package/name/file_test.go:12 +0x3c",
+								"exit status 2",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "28-long-durations.txt",
+		reportName: "28-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/slow",
+					Time: 3905.2,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestSlow",
+							Time:   182.01,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestSlower",
+							Time:   3723,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "29-coverage-build-failed.txt",
+		reportName: "29-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name:        "package/broken",
+					BuildFailed: true,
+					Time:        0,
+					Tests: []*parser.Test{
+						{
+							Name:   "[build failed]",
+							Time:   0,
+							Result: parser.FAIL,
+							Output: []string{
+								"broken.go:3: undefined: x",
+							},
+						},
+					},
+				},
+				{
+					Name: "package/covered",
+					Time: 0.1,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestA",
+							Time:   0.1,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+					CoveragePct: "50.0",
+				},
+			},
+		},
+	},
+	{
+		name:       "30-subtest-slash.txt",
+		reportName: "30-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/name",
+					Time: 0.01,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestSlash",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestSlash/a/b",
+							Parent: "TestSlash",
+							Time:   0,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "31-mixed-verbosity.txt",
+		reportName: "31-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/verbose",
+					Time: 0.01,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestA",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+				{
+					Name:  "package/quiet",
+					Time:  0.02,
+					Tests: []*parser.Test{},
+				},
+				{
+					Name: "package/quiet2",
+					Time: 0.03,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestB",
+							Time:   0.03,
+							Result: parser.FAIL,
+							Output: []string{
+								"file_test.go:10: failed",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "32-examples.txt",
+		reportName: "32-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/examples",
+					Time: 0.003,
+					Tests: []*parser.Test{
+						{
+							Name:   "ExampleHello",
+							Time:   0,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "ExampleBye",
+							Time:   0,
+							Result: parser.FAIL,
+							Output: []string{
+								"got:",
+								"hello",
+								"want:",
+								"bye",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "33-coverage-after-result.txt",
+		reportName: "33-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package1/foo",
+					Time: 0.1,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestA",
+							Time:   0.1,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+					CoveragePct: "42.0",
+				},
+				{
+					Name: "package2/bar",
+					Time: 0.2,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestB",
+							Time:   0.2,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+					CoveragePct: "13.5",
+				},
+			},
+		},
+	},
+	{
+		name:       "34-interleaved-packages.txt",
+		reportName: "34-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "pkg/a",
+					Time: 0.05,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestA1",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestA2",
+							Time:   0.03,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+				{
+					Name: "pkg/b",
+					Time: 0.03,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestB1",
+							Time:   0.02,
+							Result: parser.FAIL,
+							Output: []string{
+								"b_test.go:5: unexpected value",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "35-merge-reruns.txt",
+		reportName: "35-report.xml",
+		options:    parser.Options{MergePackages: true},
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/name",
+					Time: 0.45,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestA",
+							Time:   0.15,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestB",
+							Time:   0.2,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+				{
+					Name: "package/other",
+					Time: 0.05,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestC",
+							Time:   0.05,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "36-mixed-duration-units.txt",
+		reportName: "36-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/units",
+					Time: 0.6,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOld",
+							Time:   0.1,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestNew",
+							Time:   0.2,
+							Result: parser.FAIL,
+							Output: []string{
+								"new_test.go:8: failed",
+							},
+						},
+						{
+							Name:       "TestOldSkip",
+							Time:       0,
+							Result:     parser.SKIP,
+							SkipReason: "old_test.go:4: skipped",
+							Output: []string{
+								"old_test.go:4: skipped",
+							},
+						},
+						{
+							Name:   "TestNewSub",
+							Time:   0.3,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestNewSub/case",
+							Time:   0.3,
+							Result: parser.PASS,
+							Output: []string{},
+							Parent: "TestNewSub",
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "37-count-reruns.txt",
+		reportName: "37-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/count",
+					Time: 0.1,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestFlaky",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{},
+							Runs:   []parser.Result{parser.FAIL, parser.PASS, parser.PASS},
+							RunOutput: [][]string{
+								{"flaky_test.go:5: failed attempt"},
+								{},
+								{},
+							},
+						},
+						{
+							Name:   "TestStable",
+							Time:   0.02,
+							Result: parser.PASS,
+							Output: []string{},
+							Runs:   []parser.Result{parser.PASS, parser.PASS, parser.PASS},
+							RunOutput: [][]string{
+								{},
+								{},
+								{},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "38-count-output.txt",
+		reportName: "38-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/count",
+					Time: 0.03,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestFoo",
+							Time:   0.02,
+							Result: parser.FAIL,
+							Output: []string{
+								"    foo_test.go:10: second run",
+							},
+							Runs: []parser.Result{parser.FAIL, parser.FAIL},
+							RunOutput: [][]string{
+								{"    foo_test.go:10: first run"},
+								{"    foo_test.go:10: second run"},
+							},
+						},
+						{
+							Name:   "TestBar",
+							Time:   0,
+							Result: parser.PASS,
+							Output: []string{},
+							Runs:   []parser.Result{parser.PASS, parser.PASS},
+							RunOutput: [][]string{
+								{},
+								{},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "39-exec-wrapper.txt",
+		reportName: "39-report.xml",
+		options:    parser.Options{StripOutput: regexp.MustCompile(`^qemu: .*`)},
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/emulated",
+					Time: 0.3,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOne",
+							Time:   0.1,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestTwo",
+							Time:   0.2,
+							Result: parser.FAIL,
+							Output: []string{
+								"    two_test.go:8: unexpected value",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "40-cached.txt",
+		reportName: "40-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name:   "package/cached",
+					Time:   0,
+					Cached: true,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestA",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+				{
+					Name: "package/fresh",
+					Time: 0.02,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestB",
+							Time:   0.02,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+				{
+					Name:   "package/covered",
+					Time:   0,
+					Cached: true,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestC",
+							Time:   0.03,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+					CoveragePct: "75.0",
+				},
+			},
+		},
+	},
+	{
+		name:       "41-terraform.txt",
+		reportName: "41-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/terraform",
+					Time: 45.1,
+					Tests: []*parser.Test{
+						{
+							Name:         "TestAccResource",
+							Time:         45,
+							CreationTime: 30,
+							DestroyTime:  15,
+							Result:       parser.PASS,
+							Output:       []string{},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "42-terraform-patterns.txt",
+		reportName: "42-report.xml",
+		options: parser.Options{
+			CreationStartPattern: regexp.MustCompile(`^(\S+ \S+) \[DEBUG\] Test: creating resources in \w+$`),
+			DestroyStartPattern:  regexp.MustCompile(`^(\S+ \S+) \[DEBUG\] Test: destroying resources$`),
+		},
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/terraform",
+					Time: 50.1,
+					Tests: []*parser.Test{
+						{
+							Name:         "TestAccResource",
+							Time:         50,
+							CreationTime: 20,
+							DestroyTime:  30,
+							Result:       parser.PASS,
+							Output:       []string{},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "43-setup-output.txt",
+		reportName: "43-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/setup",
+					Time: 0.03,
+					Setup: []string{
+						"2020/01/01 10:00:00 logging initialized",
+						"connecting to database",
+					},
+					Tests: []*parser.Test{
+						{
+							Name:   "TestA",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestB",
+							Time:   0.02,
+							Result: parser.FAIL,
+							Output: []string{
+								"    b_test.go:5: unexpected value",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "44-terraform-missing-phase.txt",
+		reportName: "44-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/terraform",
+					Time: 40.1,
+					Tests: []*parser.Test{
+						{
+							Name:           "TestAccResource",
+							Time:           40,
+							CreationTime:   40,
+							DestroyTime:    0,
+							TimesEstimated: true,
+							Result:         parser.FAIL,
+							Output: []string{
+								"resource_test.go:30: timeout while waiting for state",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "45-parallel.txt",
+		reportName: "45-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/parallel",
+					Time: 0.05,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestA",
+							Time:   0.03,
+							Result: parser.FAIL,
+							Output: []string{
+								"a_test.go:10: output from A",
+							},
+						},
+						{
+							Name:   "TestB",
+							Time:   0.02,
+							Result: parser.FAIL,
+							Output: []string{
+								"b_test.go:20: output from B",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "47-terraform-count.txt",
+		reportName: "47-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/terraform",
+					Time: 65.6,
+					Tests: []*parser.Test{
+						{
+							Name:           "TestAccResource",
+							Time:           20,
+							CreationTime:   20,
+							DestroyTime:    0,
+							TimesEstimated: true,
+							Result:         parser.FAIL,
+							Output: []string{
+								"resource_test.go:30: apply failed",
+							},
+							Runs: []parser.Result{parser.PASS, parser.FAIL},
+							RunOutput: [][]string{
+								{},
+								{"resource_test.go:30: apply failed"},
+							},
+						},
+						{
+							Name:         "TestUnit",
+							Time:         0.5,
+							CreationTime: 0,
+							DestroyTime:  0.5,
+							Result:       parser.PASS,
+							Output:       []string{},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "65-testify-suite.txt",
+		reportName: "65-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/suite",
+					Time: 0.015,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestExampleSuite",
+							Time:   0.01,
+							Result: parser.FAIL,
+							Output: []string{
+								"    example_test.go:20: SetupSuite: connecting",
+								"    example_test.go:24: TearDownSuite: closing",
+							},
+						},
+						{
+							Name:   "TestExampleSuite/TestOne",
+							Parent: "TestExampleSuite",
+							Time:   0,
+							Result: parser.PASS,
+							Output: []string{
+								"    example_test.go:30: one",
+							},
+						},
+						{
+							Name:   "TestExampleSuite/TestTwo",
+							Parent: "TestExampleSuite",
+							Time:   0,
+							Result: parser.FAIL,
+							Output: []string{
+								"    example_test.go:35: two",
+								"    example_test.go:36: ",
+								"Error Trace:\texample_test.go:36",
+								"Error:      \tShould be true",
+								"Test:       \tTestExampleSuite/TestTwo",
+							},
+						},
+					},
+				},
+				{
+					Name: "package/other",
+					Time: 0.055,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOtherSuite",
+							Time:   0.05,
+							Result: parser.FAIL,
+							Output: []string{},
+						},
+						{
+							Name:   "TestOtherSuite/TestThree",
+							Parent: "TestOtherSuite",
+							Time:   0.02,
+							Result: parser.PASS,
+							Output: []string{
+								"    other_test.go:12: three",
+							},
+						},
+						{
+							Name:   "TestOtherSuite/TestFour",
+							Parent: "TestOtherSuite",
+							Time:   0.03,
+							Result: parser.FAIL,
+							Output: []string{
+								"    other_test.go:17: four",
+								"Error Trace:\tother_test.go:17",
+								"Error:      \tNot equal",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "48-terraform-destroy-steps.txt",
+		reportName: "48-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/terraform",
+					Time: 60.1,
+					Tests: []*parser.Test{
+						{
+							Name:         "TestAccResource",
+							Time:         60,
+							CreationTime: 40,
+							DestroyTime:  20,
+							Result:       parser.PASS,
+							Output:       []string{},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "49-terraform-log-level.txt",
+		reportName: "49-report.xml",
+		options: parser.Options{
+			LogLevelPattern: regexp.MustCompile(`level=\w+`),
+		},
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/terraform",
+					Time: 40.1,
+					Tests: []*parser.Test{
+						{
+							Name:         "TestAccResource",
+							Time:         40,
+							CreationTime: 25,
+							DestroyTime:  15,
+							Result:       parser.PASS,
+							Output:       []string{},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "50-crlf.txt",
+		reportName: "50-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name:        "package/windows",
+					Time:        0.04,
+					CoveragePct: "50.0",
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOne",
+							Time:   0.02,
+							Result: parser.FAIL,
+							Output: []string{"one_test.go:10: not equal"},
+						},
+						{
+							Name:   "TestTwo",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "51-total-coverage.txt",
+		reportName: "51-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name:        "package/foo",
+					Time:        0.1,
+					Tests:       []*parser.Test{},
+					CoveragePct: "40.0",
+				},
+				{
+					Name:        "package/bar",
+					Time:        0.2,
+					Tests:       []*parser.Test{},
+					CoveragePct: "60.0",
+				},
+			},
+			TotalCoverage: "47.8",
+		},
+	},
+	{
+		name:       "52-timeout.txt",
+		reportName: "52-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/name",
+					Time: 1.012,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestFast",
+							Time:   0,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:     "TestSlow",
+							Time:     0,
+							Result:   parser.FAIL,
+							TimedOut: true,
+							Output: []string{
+								"panic: test timed out after 1s",
+								"running tests:",
+								"\tTestSlow (1s)",
+								"",
+								"goroutine 17 [running]:",
+								"testing.(*M).startAlarm.func1()",
+								"\t/usr/local/go/src/testing/testing.go:2259 +0x30c",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "53-example-blank-lines.txt",
+		reportName: "53-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/examples",
+					Time: 0.002,
+					Tests: []*parser.Test{
+						{
+							Name:   "ExampleList",
+							Time:   0,
+							Result: parser.FAIL,
+							Output: []string{
+								"got:",
+								"a",
+								"",
+								"b",
+								"want:",
+								"a",
+								"b",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "54-race.txt",
+		reportName: "54-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/name",
+					Time: 0.015,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOne",
+							Time:   0,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestRace",
+							Time:   0,
+							Result: parser.FAIL,
+							Raced:  true,
+							Output: []string{
+								"race_test.go:10: starting",
+								"==================",
+								"WARNING: DATA RACE",
+								"Write at 0x00c00001c0f8 by goroutine 8:",
+								"  package/name.TestRace.func1()",
+								"      /src/package/name/race_test.go:12 +0x44",
+								"",
+								"Previous read at 0x00c00001c0f8 by goroutine 7:",
+								"  package/name.TestRace()",
+								"      /src/package/name/race_test.go:14 +0x9c",
+								"==================",
+								"testing.go:1319: race detected during execution of test",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "55-failure-names.txt",
+		reportName: "55-report.xml",
+		options: parser.Options{
+			BuildFailureName:  "{package} [build failed]",
+			NoTestFailureName: "{package}.TestMain",
+		},
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name:        "package/broken",
+					BuildFailed: true,
+					Tests: []*parser.Test{
+						{
+							Name:   "package/broken [build failed]",
+							Result: parser.FAIL,
+							Output: []string{
+								"broken.go:3: undefined: x",
+							},
+						},
+					},
+				},
+				{
+					Name: "package/nodb",
+					Time: 0.005,
+					Tests: []*parser.Test{
+						{
+							Name:   "package/nodb.TestMain",
+							Result: parser.FAIL,
+							Output: []string{
+								"setup failed: no database",
+							},
+							ErrorKind: parser.ErrorSetup,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "56-color.txt",
+		reportName: "56-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/color",
+					Time: 0.03,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOne",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestTwo",
+							Time:   0.02,
+							Result: parser.FAIL,
+							Output: []string{
+								"two_test.go:9: got 1, want 2",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "57-no-tests.txt",
+		reportName: "57-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/leak",
+					Time: 0.002,
+					Tests: []*parser.Test{
+						{
+							Name:   "Failure",
+							Result: parser.FAIL,
+							Output: []string{
+								"leaked goroutines",
+							},
+							ErrorKind: parser.ErrorSetup,
+						},
+					},
+					NoTests: true,
+				},
+				{
+					Name:    "package/empty",
+					Time:    0.001,
+					Tests:   []*parser.Test{},
+					NoTests: true,
+				},
+				{
+					Name:    "package/cached",
+					Tests:   []*parser.Test{},
+					Cached:  true,
+					NoTests: true,
+				},
+			},
+		},
+	},
+	{
+		name:       "58-gotestsum.txt",
+		reportName: "58-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "example.com/pkg",
+					Time: 0.012,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOne",
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestTwo",
+							Result: parser.FAIL,
+							Output: []string{
+								"two_test.go:9: got 1, want 2",
+							},
+						},
+					},
+				},
+				{
+					Name: "example.com/other",
+					Time: 0.004,
+					Tests: []*parser.Test{
+						{
+							Name:       "TestSkip",
+							Result:     parser.SKIP,
+							SkipReason: "skip_test.go:5: not supported",
+							Output: []string{
+								"skip_test.go:5: not supported",
+							},
+						},
+					},
+				},
+			},
+			Summary: &parser.Summary{
+				Tests:    3,
+				Skipped:  1,
+				Failures: 1,
+				Time:     0.456,
+			},
+		},
+	},
+	{
+		name:        "59-subtest-time.txt",
+		reportName:  "59-report.xml",
+		packageName: "package/compiled",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/compiled",
+					Time: 0.45,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestA",
+							Time:   0.4,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestA/b",
+							Time:   0.2,
+							Result: parser.PASS,
+							Output: []string{},
+							Parent: "TestA",
+						},
+						{
+							Name:   "TestA/b/c",
+							Time:   0.1,
+							Result: parser.PASS,
+							Output: []string{},
+							Parent: "TestA/b",
+						},
+						{
+							Name:   "TestA/d",
+							Time:   0.15,
+							Result: parser.PASS,
+							Output: []string{},
+							Parent: "TestA",
+						},
+						{
+							Name:   "TestE",
+							Time:   0.05,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "60-parallel-packages.txt",
+		reportName: "60-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "pkg/a",
+					Time: 0.02,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestA1",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+				{
+					Name: "pkg/b",
+					Time: 0.03,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestB1",
+							Time:   0.02,
+							Result: parser.FAIL,
+							Output: []string{
+								"b_test.go:5: unexpected value",
+							},
+						},
+					},
+				},
+				{
+					Name:        "pkg/c",
+					BuildFailed: true,
+					Tests: []*parser.Test{
+						{
+							Name:   "[build failed]",
+							Result: parser.FAIL,
+							Output: []string{
+								"c.go:3:2: undefined: y",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "61-skip-reason.txt",
+		reportName: "61-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/skip",
+					Time: 0.01,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestSkip",
+							Result: parser.SKIP,
+							Output: []string{
+								"skip_test.go:12: not supported on this platform",
+							},
+							SkipReason: "skip_test.go:12: not supported on this platform",
+						},
+						{
+							Name:   "TestParent",
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "TestParent/sub",
+							Result: parser.SKIP,
+							Output: []string{
+								"sub_test.go:7: needs network",
+							},
+							Parent:     "TestParent",
+							SkipReason: "sub_test.go:7: needs network",
+						},
+						{
+							Name:   "TestNewSkip",
+							Result: parser.SKIP,
+							Output: []string{
+								"    new_test.go:9: setup done",
+								"    new_test.go:10: not supported",
+							},
+							SkipReason: "new_test.go:10: not supported",
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "62-subtest-output.txt",
+		reportName: "62-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/subtests",
+					Time: 0.3,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestFoo",
+							Time:   0.3,
+							Result: parser.FAIL,
+							Output: []string{
+								"    foo_test.go:6: parent before",
+								"    foo_test.go:11: parent after",
+								"    foo_test.go:15: parent fails",
+							},
+						},
+						{
+							Name:   "TestFoo/Bar",
+							Time:   0.1,
+							Result: parser.FAIL,
+							Output: []string{
+								"    foo_test.go:8: sub",
+								"    foo_test.go:9: sub fails",
+							},
+							Parent: "TestFoo",
+						},
+						{
+							Name:   "TestFoo/Baz",
+							Time:   0.2,
+							Result: parser.PASS,
+							Output: []string{
+								"    foo_test.go:13: baz",
+							},
+							Parent: "TestFoo",
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "63-failures-outside-tests.txt",
+		reportName: "63-report.xml",
+		options: parser.Options{
+			NoTestFailureName: "{package}.TestMain",
+		},
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/race",
+					Time: 0.02,
+					Tests: []*parser.Test{
+						{
+							Name:   "package/race.TestMain",
+							Result: parser.FAIL,
+							Raced:  true,
+							Output: []string{
+								"==================",
+								"WARNING: DATA RACE",
+								"Write at 0x00c000012345 by goroutine 7:",
+								"  package/race.init.0()",
+								"==================",
+							},
+						},
+						{
+							Name:   "TestTwo",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+				{
+					Name: "package/init",
+					Time: 0.005,
+					Tests: []*parser.Test{
+						{
+							Name:   "package/init.TestMain",
+							Result: parser.FAIL,
+							Output: []string{
+								"panic: init failed",
+								"",
+								"goroutine 1 [running]:",
+								"package/init.init.0()",
+							},
+							ErrorKind: parser.ErrorSetup,
+						},
+					},
+				},
+				{
+					Name: "package/panic",
+					Time: 0.01,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOne",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+						{
+							Name:   "package/panic.TestMain",
+							Result: parser.FAIL,
+							Output: []string{
+								"panic: boom",
+								"",
+								"goroutine 1 [running]:",
+								"main.main()",
+								"\t/tmp/main.go:5 +0x25",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "64-interleaved-coverage.txt",
+		reportName: "64-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "pkg/b",
+					Time: 0.03,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestB1",
+							Time:   0.02,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+				{
+					Name: "pkg/a",
+					Time: 0.05,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestA1",
+							Time:   0.01,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+					Benchmarks: []*parser.Benchmark{
+						{
+							Name:       "BenchmarkA",
+							Iterations: 1000,
+							NsPerOp:    1200,
+						},
+					},
+					CoveragePct: "75.0",
+				},
+			},
+		},
+	},
+	{
+		name:       "66-json-build-failed.txt",
+		reportName: "66-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/name/passing",
+					Time: 0.021,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestOne",
+							Time:   0.02,
+							Result: parser.PASS,
+							Output: []string{},
+						},
+					},
+				},
+				{
+					Name:        "package/name/failing1",
+					BuildFailed: true,
+					Tests: []*parser.Test{
+						{
+							Name:   "[build failed]",
+							Time:   0,
+							Result: parser.FAIL,
+							Output: []string{
+								"failing1/failing_test.go:15: undefined: x",
+							},
+						},
+					},
+				},
+				{
+					Name:        "package/name/failing2",
+					BuildFailed: true,
+					Tests: []*parser.Test{
+						{
+							Name:   "[build failed]",
+							Time:   0,
+							Result: parser.FAIL,
+							Output: []string{
+								"failing2/another_failing_test.go:20: undefined: y",
+							},
+						},
+					},
+				},
+			},
+		},
+		jsonInput: true,
+	},
+	{
+		name:       "67-terraform-replace.txt",
+		reportName: "67-report.xml",
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/terraform",
+					Time: 50.1,
+					Tests: []*parser.Test{
+						{
+							Name:         "TestAccResource_replace",
+							Time:         50,
+							CreationTime: 35,
+							DestroyTime:  15,
+							Result:       parser.PASS,
+							Output:       []string{},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name:       "68-json-count.txt",
+		reportName: "68-report.xml",
+		jsonInput:  true,
+		report: &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/count",
+					Time: 0.06,
+					Tests: []*parser.Test{
+						{
+							Name:    "TestFlaky",
+							Time:    0.02,
+							Result:  parser.PASS,
+							Output:  []string{},
+							Package: "package/count",
+							Runs:    []parser.Result{parser.FAIL, parser.PASS},
+							RunOutput: [][]string{
+								{"flaky_test.go:8: unlucky"},
+								{},
+							},
+						},
+						{
+							Name:   "TestRace",
+							Time:   0.03,
+							Result: parser.FAIL,
+							Output: []string{
+								"==================",
+								"WARNING: DATA RACE",
+								"==================",
+								"testing.go:1152: race detected during execution of test",
+							},
+							Package: "package/count",
+							Raced:   true,
+						},
+					},
+				},
+				{
+					Name: "package/timeout",
+					Time: 1.01,
+					Tests: []*parser.Test{
+						{
+							Name:   "TestSlow",
+							Result: parser.FAIL,
+							Output: []string{
+								"panic: test timed out after 1s",
+							},
+							Package:  "package/timeout",
+							TimedOut: true,
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+func TestParser(t *testing.T) {
+	for _, testCase := range testCases {
+		t.Logf("Running: %s", testCase.name)
+
+		file, err := os.Open("tests/" + testCase.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var report *parser.Report
+		if testCase.jsonInput {
+			report, err = parser.ParseJSON(file, testCase.packageName)
+		} else {
+			report, err = parser.ParseWithOptions(file, testCase.packageName, testCase.options)
+		}
+		if err != nil {
+			t.Fatalf("error parsing: %s", err)
+		}
+
+		if report == nil {
+			t.Fatalf("Report == nil")
+		}
+
+		expected := testCase.report
+		if len(report.Packages) != len(expected.Packages) {
+			t.Fatalf("Report packages == %d, want %d", len(report.Packages), len(expected.Packages))
+		}
+
+		if report.TotalCoverage != expected.TotalCoverage {
+			t.Errorf("Report.TotalCoverage == %s, want %s", report.TotalCoverage, expected.TotalCoverage)
+		}
+
+		if !reflect.DeepEqual(report.Summary, expected.Summary) {
+			t.Errorf("Report.Summary == %+v, want %+v", report.Summary, expected.Summary)
+		}
+
+		for i, pkg := range report.Packages {
+			expPkg := expected.Packages[i]
+
+			if pkg.Name != expPkg.Name {
+				t.Errorf("Package.Name == %s, want %s", pkg.Name, expPkg.Name)
+			}
+
+			if pkg.BuildFailed != expPkg.BuildFailed {
+				t.Errorf("Package.BuildFailed == %v, want %v", pkg.BuildFailed, expPkg.BuildFailed)
+			}
+
+			if strings.Join(pkg.Setup, "\n") != strings.Join(expPkg.Setup, "\n") {
+				t.Errorf("Package.Setup == %q, want %q", pkg.Setup, expPkg.Setup)
+			}
+
+			if pkg.Cached != expPkg.Cached {
+				t.Errorf("Package.Cached == %v, want %v", pkg.Cached, expPkg.Cached)
+			}
+
+			if pkg.NoTests != expPkg.NoTests {
+				t.Errorf("Package.NoTests == %v, want %v", pkg.NoTests, expPkg.NoTests)
+			}
+
+			if pkg.Hostname != expPkg.Hostname {
+				t.Errorf("Package.Hostname == %s, want %s", pkg.Hostname, expPkg.Hostname)
+			}
+
+			if pkg.Time != expPkg.Time {
+				t.Errorf("Package.Time == %d, want %d", pkg.Time, expPkg.Time)
+			}
+
+			if len(pkg.Tests) != len(expPkg.Tests) {
+				t.Fatalf("Package Tests == %d, want %d", len(pkg.Tests), len(expPkg.Tests))
+			}
+
+			for j, test := range pkg.Tests {
+				expTest := expPkg.Tests[j]
+
+				if test.Name != expTest.Name {
+					t.Errorf("Test.Name == %s, want %s", test.Name, expTest.Name)
+				}
+
+				if test.Time != expTest.Time {
+					t.Errorf("Test.Time == %d, want %d", test.Time, expTest.Time)
+				}
+
+				if test.CreationTime != expTest.CreationTime {
+					t.Errorf("Test.CreationTime (%s) == %v, want %v", test.Name, test.CreationTime, expTest.CreationTime)
+				}
+
+				if test.Raced != expTest.Raced {
+					t.Errorf("Test.Raced (%s) == %v, want %v", test.Name, test.Raced, expTest.Raced)
+				}
+
+				if test.TimedOut != expTest.TimedOut {
+					t.Errorf("Test.TimedOut (%s) == %v, want %v", test.Name, test.TimedOut, expTest.TimedOut)
+				}
+
+				if test.SkipReason != expTest.SkipReason {
+					t.Errorf("Test.SkipReason (%s) == %q, want %q", test.Name, test.SkipReason, expTest.SkipReason)
+				}
+
+				if test.ErrorKind != expTest.ErrorKind {
+					t.Errorf("Test.ErrorKind (%s) == %q, want %q", test.Name, test.ErrorKind, expTest.ErrorKind)
+				}
+
+				if test.TimesEstimated != expTest.TimesEstimated {
+					t.Errorf("Test.TimesEstimated (%s) == %v, want %v", test.Name, test.TimesEstimated, expTest.TimesEstimated)
+				}
+
+				if test.Parent != expTest.Parent {
+					t.Errorf("Test.Parent (%s) == %s, want %s", test.Name, test.Parent, expTest.Parent)
+				}
+
+				if test.Package != pkg.Name {
+					t.Errorf("Test.Package (%s) == %s, want %s", test.Name, test.Package, pkg.Name)
+				}
+
+				if test.Result != expTest.Result {
+					t.Errorf("Test.Result == %d, want %d", test.Result, expTest.Result)
+				}
+
+				if fmt.Sprint(test.Runs) != fmt.Sprint(expTest.Runs) {
+					t.Errorf("Test.Runs (%s) == %v, want %v", test.Name, test.Runs, expTest.Runs)
+				}
+
+				if fmt.Sprintf("%q", test.RunOutput) != fmt.Sprintf("%q", expTest.RunOutput) {
+					t.Errorf("Test.RunOutput (%s) == %q, want %q", test.Name, test.RunOutput, expTest.RunOutput)
+				}
+
+				testOutput := strings.Join(test.Output, "\n")
+				expTestOutput := strings.Join(expTest.Output, "\n")
+				if testOutput != expTestOutput {
+					t.Errorf("Test.Output (%s) ==\n%s\n, want\n%s", test.Name, testOutput, expTestOutput)
+				}
+			}
+
+			if len(pkg.Benchmarks) != len(expPkg.Benchmarks) {
+				t.Fatalf("Package Benchmarks == %d, want %d", len(pkg.Benchmarks), len(expPkg.Benchmarks))
+			}
+
+			for j, benchmark := range pkg.Benchmarks {
+				if expBenchmark := expPkg.Benchmarks[j]; *benchmark != *expBenchmark {
+					t.Errorf("Benchmark == %+v, want %+v", *benchmark, *expBenchmark)
+				}
+			}
+
+			if pkg.CoveragePct != expPkg.CoveragePct {
+				t.Errorf("Package.CoveragePct == %s, want %s", pkg.CoveragePct, expPkg.CoveragePct)
+			}
+		}
+	}
+}
+
+func TestJUnitFormatter(t *testing.T) {
+	testJUnitFormatter(t, "")
+}
+
+func TestVersionFlag(t *testing.T) {
+	testJUnitFormatter(t, "custom-version")
+}
+
+func testJUnitFormatter(t *testing.T, goVersion string) {
+	for _, testCase := range testCases {
+		report, err := loadTestReport(testCase.reportName, goVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var junitReport bytes.Buffer
+
+		if err = formatter.JUnitReportXML(testCase.report, testCase.noXMLHeader, goVersion, &junitReport); err != nil {
+			t.Fatal(err)
+		}
+
+		if string(junitReport.Bytes()) != report {
+			t.Errorf("Fail: %s Report xml ==\n%s, want\n%s", testCase.name, string(junitReport.Bytes()), report)
+		}
+	}
+}
+
+func loadTestReport(name, goVersion string) (string, error) {
+	contents, err := ioutil.ReadFile("tests/" + name)
+	if err != nil {
+		return "", err
+	}
+
+	if goVersion == "" {
+		// if goVersion is not specified, default to runtime version
+		goVersion = formatter.DefaultGoVersion()
+	}
+
+	// replace value="1.0" With actual version
+	report := strings.Replace(string(contents), `value="1.0"`, fmt.Sprintf(`value="%s"`, goVersion), -1)
+
+	return report, nil
+}
+
+func TestFilterByDuration(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name: "package/slow",
+				Time: 1.5,
+				Tests: []*parser.Test{
+					{Name: "TestFast", Time: 0.01, Result: parser.PASS},
+					{Name: "TestSlow", Time: 1.2, Result: parser.PASS},
+					{Name: "TestThreshold", Time: 0.5, Result: parser.FAIL},
+				},
+			},
+			{
+				Name: "package/fast",
+				Time: 0.2,
+				Tests: []*parser.Test{
+					{Name: "TestFast", Time: 0.1, Result: parser.PASS},
+				},
+			},
+		},
+	}
+
+	filtered := report.FilterByDuration(0.5)
+
+	if len(filtered.Packages) != 1 {
+		t.Fatalf("Report packages == %d, want 1", len(filtered.Packages))
+	}
+
+	pkg := filtered.Packages[0]
+	if pkg.Name != "package/slow" {
+		t.Errorf("Package.Name == %s, want package/slow", pkg.Name)
+	}
+
+	expected := []string{"TestSlow", "TestThreshold"}
+	if len(pkg.Tests) != len(expected) {
+		t.Fatalf("Package Tests == %d, want %d", len(pkg.Tests), len(expected))
+	}
+	for i, test := range pkg.Tests {
+		if test.Name != expected[i] {
+			t.Errorf("Test.Name == %s, want %s", test.Name, expected[i])
+		}
+	}
+
+	if len(report.Packages[0].Tests) != 3 {
+		t.Errorf("original report was modified")
+	}
+}
+
+func TestJSONFormatter(t *testing.T) {
+	for _, testCase := range testCases {
+		var jsonReport bytes.Buffer
+
+		if err := formatter.JSONReport(testCase.report, &jsonReport); err != nil {
+			t.Fatal(err)
+		}
+
+		var report struct {
+			Packages []struct {
+				Name        string            `json:"name"`
+				Tests       []json.RawMessage `json:"tests"`
+				BuildFailed bool              `json:"buildFailed"`
+			} `json:"packages"`
+		}
+		if err := json.Unmarshal(jsonReport.Bytes(), &report); err != nil {
+			t.Fatalf("Fail: %s invalid JSON: %s\n%s", testCase.name, err, jsonReport.String())
+		}
+
+		if len(report.Packages) != len(testCase.report.Packages) {
+			t.Fatalf("Fail: %s packages == %d, want %d", testCase.name, len(report.Packages), len(testCase.report.Packages))
+		}
+		for i, pkg := range report.Packages {
+			expPkg := testCase.report.Packages[i]
+			if pkg.Name != expPkg.Name {
+				t.Errorf("Package.Name == %s, want %s", pkg.Name, expPkg.Name)
+			}
+			if pkg.BuildFailed != expPkg.BuildFailed {
+				t.Errorf("Package.BuildFailed == %v, want %v", pkg.BuildFailed, expPkg.BuildFailed)
+			}
+			if pkg.Tests == nil {
+				t.Errorf("Fail: %s package %s tests == null, want array", testCase.name, pkg.Name)
+			}
+			if len(pkg.Tests) != len(expPkg.Tests) {
+				t.Errorf("Package Tests == %d, want %d", len(pkg.Tests), len(expPkg.Tests))
+			}
+		}
+	}
+}
+
+func TestJSONFlatFormatter(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name:  "package/empty",
+				Tests: []*parser.Test{},
+			},
+			{
+				Name: "package/name",
+				Tests: []*parser.Test{
+					{Name: "TestOne", Time: 0.02, Result: parser.PASS, Output: []string{}, Package: "package/name"},
+				},
+			},
+		},
+	}
+
+	var flatReport bytes.Buffer
+	if err := formatter.JSONFlatReport(report, &flatReport); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[],[{"name":"TestOne","time":0.02,"creationTime":0,"destroyTime":0,"result":0,"output":[],"package":"package/name","isSubtest":false,"topLevelName":"TestOne"}]` + "\n"
+	if flatReport.String() != expected {
+		t.Errorf("Report json ==\n%s, want\n%s", flatReport.String(), expected)
+	}
+}
+
+func TestJSONCoverageFormatter(t *testing.T) {
+	file, err := os.Open("tests/10-multipkg-coverage.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.Parse(file, "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	expected, err := ioutil.ReadFile("tests/10-coverage.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var coverageReport bytes.Buffer
+	if err := formatter.JSONCoverageReport(report, "set", &coverageReport); err != nil {
+		t.Fatal(err)
+	}
+
+	if coverageReport.String() != string(expected) {
+		t.Errorf("Report json ==\n%s, want\n%s", coverageReport.String(), expected)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name         string
+		setExitCode  bool
+		requireTests bool
+		failOnSkip   bool
+		want         int
+	}{
+		{"01-pass.txt", false, false, false, 0},
+		{"01-pass.txt", true, false, false, 0},
+		{"01-pass.txt", true, true, false, 0},
+		{"01-pass.txt", true, false, true, 0},
+		{"02-fail.txt", false, false, false, 0},
+		{"02-fail.txt", true, false, false, 1},
+		{"03-skip.txt", true, false, false, 0},
+		{"03-skip.txt", false, false, true, 0},
+		{"03-skip.txt", true, false, true, 1},
+		{"15-empty.txt", true, false, false, 0},
+		{"15-empty.txt", false, true, false, 0},
+		{"15-empty.txt", true, true, false, 1},
+		{"55-failure-names.txt", true, false, false, 1},
+	}
+
+	for _, test := range tests {
+		file, err := os.Open("tests/" + test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := parser.Parse(file, "")
+		file.Close()
+		if err != nil {
+			t.Fatalf("error parsing: %s", err)
+		}
+
+		if got := exitCode(report, test.setExitCode, test.requireTests, test.failOnSkip); got != test.want {
+			t.Errorf("exitCode(%s, %v, %v, %v) == %d, want %d", test.name, test.setExitCode, test.requireTests, test.failOnSkip, got, test.want)
+		}
+	}
+
+	empty, err := parser.Parse(strings.NewReader(""), "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+	if got := exitCode(empty, true, false, false); got != 0 {
+		t.Errorf("exitCode(empty input, true, false, false) == %d, want 0", got)
+	}
+	if got := exitCode(empty, true, true, false); got != 1 {
+		t.Errorf("exitCode(empty input, true, true, false) == %d, want 1", got)
+	}
+}
+
+func TestConsole(t *testing.T) {
+	var debug bytes.Buffer
+	parser.Console.Target = &debug
+	defer func() { parser.Console.Target = nil }()
+
+	file, err := os.Open("tests/01-pass.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := parser.Parse(file, ""); err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	if !strings.Contains(debug.String(), "TestZ: creation") {
+		t.Errorf("Console output ==\n%s, want creation and destroy times of TestZ", debug.String())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	base := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name: "package/name",
+				Tests: []*parser.Test{
+					{Name: "TestStillPassing", Result: parser.PASS},
+					{Name: "TestBreaks", Result: parser.PASS},
+					{Name: "TestFixed", Result: parser.FAIL},
+					{Name: "TestStillFailing", Result: parser.FAIL},
+					{Name: "TestRemoved", Result: parser.PASS},
+				},
+			},
+		},
+	}
+	head := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name: "package/name",
+				Tests: []*parser.Test{
+					{Name: "TestStillPassing", Result: parser.PASS},
+					{Name: "TestBreaks", Result: parser.FAIL},
+					{Name: "TestFixed", Result: parser.PASS},
+					{Name: "TestStillFailing", Result: parser.FAIL},
+					{Name: "TestAdded", Result: parser.PASS},
+					{Name: "TestAddedFailing", Result: parser.FAIL},
+				},
+			},
+		},
+	}
+
+	diff := parser.Diff(base, head)
+
+	checkIDs := func(category string, got []parser.TestID, want ...string) {
+		if len(got) != len(want) {
+			t.Errorf("%s == %v, want %v", category, got, want)
+			return
+		}
+		for i, id := range got {
+			if id.Package != "package/name" || id.Name != want[i] {
+				t.Errorf("%s == %v, want %v", category, got, want)
+				return
+			}
+		}
+	}
+
+	checkIDs("NewFailures", diff.NewFailures, "TestBreaks", "TestAddedFailing")
+	checkIDs("Fixed", diff.Fixed, "TestFixed")
+	checkIDs("Added", diff.Added, "TestAdded", "TestAddedFailing")
+	checkIDs("Removed", diff.Removed, "TestRemoved")
+}
+
+func TestLowCoverage(t *testing.T) {
+	file, err := os.Open("tests/51-total-coverage.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.Parse(file, "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	if pct, ok := report.Packages[0].Coverage(); !ok || pct != 40 {
+		t.Errorf("Coverage() == %v, %v, want 40, true", pct, ok)
+	}
+	if pct, ok := report.Coverage(); !ok || pct != 47.8 {
+		t.Errorf("Report.Coverage() == %v, %v, want 47.8, true", pct, ok)
+	}
+	if _, ok := (&parser.Package{}).Coverage(); ok {
+		t.Errorf("Coverage() of package without coverage == true, want false")
+	}
+
+	tests := []struct {
+		min  float64
+		want []string
+	}{
+		{10, nil},
+		{50, []string{
+			"Coverage of package/foo is 40.0%, below 50%",
+			"Total coverage is 47.8%, below 50%",
+		}},
+	}
+	for _, test := range tests {
+		if got := lowCoverage(report, test.min); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("lowCoverage(%v) == %q, want %q", test.min, got, test.want)
+		}
+	}
+}
+
+func TestReportSuccess(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"01-pass.txt", true},
+		{"02-fail.txt", false},
+		{"03-skip.txt", true},
+		{"15-empty.txt", true},
+		{"29-coverage-build-failed.txt", false},
+	}
+
+	for _, test := range tests {
+		file, err := os.Open("tests/" + test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := parser.Parse(file, "")
+		file.Close()
+		if err != nil {
+			t.Fatalf("error parsing: %s", err)
+		}
+
+		if got := report.Success(); got != test.want {
+			t.Errorf("Success() of %s == %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// a build failure is a failure even without a failed test
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{Name: "package/name", BuildFailed: true},
+		},
+	}
+	if report.Success() {
+		t.Errorf("Success() of build failure without tests == true, want false")
+	}
+}
+
+func TestMergeBuildFailed(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name:        "package/name",
+				BuildFailed: true,
+				Tests:       []*parser.Test{{Name: "[build failed]", Result: parser.FAIL}},
+			},
+		},
+	}
+	report.Merge(&parser.Report{
+		Packages: []parser.Package{
+			{
+				Name:  "package/name",
+				Time:  0.1,
+				Tests: []*parser.Test{{Name: "TestOne", Result: parser.PASS}},
+			},
+		},
+	})
+
+	pkg := report.Packages[0]
+	if pkg.BuildFailed {
+		t.Errorf("BuildFailed after a successful rerun == true, want false")
+	}
+	if len(pkg.Tests) != 1 || pkg.Tests[0].Name != "TestOne" {
+		t.Errorf("Tests after a successful rerun == %v, want only TestOne", pkg.Tests)
+	}
+	if !report.Success() {
+		t.Errorf("Success() after a successful rerun == false, want true")
+	}
+}
+
+func TestFilterChanged(t *testing.T) {
+	base := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name: "package/one",
+				Tests: []*parser.Test{
+					{Name: "TestBreaks", Result: parser.PASS},
+					{Name: "TestFixed", Result: parser.FAIL},
+					{Name: "TestUnchanged", Result: parser.PASS},
+				},
+			},
+			{
+				Name: "package/two",
+				Tests: []*parser.Test{
+					{Name: "TestUnchanged", Result: parser.FAIL},
+				},
+			},
+		},
+	}
+	head := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name: "package/one",
+				Tests: []*parser.Test{
+					{Name: "TestBreaks", Result: parser.FAIL},
+					{Name: "TestFixed", Result: parser.PASS},
+					{Name: "TestUnchanged", Result: parser.PASS},
+				},
+			},
+			{
+				Name: "package/two",
+				Tests: []*parser.Test{
+					{Name: "TestUnchanged", Result: parser.FAIL},
+				},
+			},
+		},
+	}
+
+	changed := parser.FilterChanged(base, head)
+
+	if len(changed.Packages) != 1 {
+		t.Fatalf("Report packages == %d, want 1", len(changed.Packages))
+	}
+
+	pkg := changed.Packages[0]
+	expected := []string{"TestBreaks", "TestFixed"}
+	if len(pkg.Tests) != len(expected) {
+		t.Fatalf("Package Tests == %d, want %d", len(pkg.Tests), len(expected))
+	}
+	for i, test := range pkg.Tests {
+		if test.Name != expected[i] {
+			t.Errorf("Test.Name == %s, want %s", test.Name, expected[i])
+		}
+	}
+}
+
+func TestReportCounters(t *testing.T) {
+	file, err := os.Open("tests/21-json.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.ParseJSON(file, "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	if got := report.Passed(); got != 1 {
+		t.Errorf("Report.Passed() == %d, want 1", got)
+	}
+	if got := report.Failures(); got != 1 {
+		t.Errorf("Report.Failures() == %d, want 1", got)
+	}
+	if got := report.Skipped(); got != 1 {
+		t.Errorf("Report.Skipped() == %d, want 1", got)
+	}
+	if got := report.Total(); got != 3 {
+		t.Errorf("Report.Total() == %d, want 3", got)
+	}
+}
+
+func TestWrapCDATA(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name:  "package/name",
+				Setup: []string{"setup <b>"},
+				Tests: []*parser.Test{
+					{
+						Name:   "TestCDATA",
+						Result: parser.FAIL,
+						Output: []string{"got <a>]]></a>"},
+					},
+				},
+			},
+		},
+	}
+
+	var junitReport bytes.Buffer
+	if err := formatter.JUnitReportXMLWithOptions(report, true, "1.0", formatter.Options{WrapCDATA: true}, &junitReport); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<![CDATA[got <a>]]]]><![CDATA[></a>]]></failure>`
+	if !strings.Contains(junitReport.String(), expected) {
+		t.Errorf("Report xml ==\n%s, want failure containing\n%s", junitReport.String(), expected)
+	}
+
+	// the output of the package setup is wrapped as well
+	expected = "</testcase>\n\t\t<system-out><![CDATA[setup <b>]]></system-out>"
+	if !strings.Contains(junitReport.String(), expected) {
+		t.Errorf("Report xml ==\n%s, want suite system-out containing\n%s", junitReport.String(), expected)
+	}
+
+	var suites struct {
+		Failure string `xml:"testsuite>testcase>failure"`
+	}
+	if err := xml.Unmarshal(junitReport.Bytes(), &suites); err != nil {
+		t.Fatalf("invalid xml: %s", err)
+	}
+	if suites.Failure != "got <a>]]></a>" {
+		t.Errorf("Failure == %s, want %s", suites.Failure, "got <a>]]></a>")
+	}
+
+	// the output of other tests is written to system-out
+	report.Packages[0].Tests[0].Result = parser.PASS
+	junitReport.Reset()
+	if err := formatter.JUnitReportXMLWithOptions(report, true, "1.0", formatter.Options{WrapCDATA: true}, &junitReport); err != nil {
+		t.Fatal(err)
+	}
+
+	expected = `<system-out><![CDATA[got <a>]]]]><![CDATA[></a>]]></system-out>`
+	if !strings.Contains(junitReport.String(), expected) {
+		t.Errorf("Report xml ==\n%s, want system-out containing\n%s", junitReport.String(), expected)
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{Name: "package/one", Tests: []*parser.Test{}},
+			{Name: "package/two", Tests: []*parser.Test{}},
+		},
+	}
+
+	var junitReport bytes.Buffer
+	timestamp := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := formatter.JUnitReportXMLWithOptions(report, true, "1.0", formatter.Options{Timestamp: timestamp}, &junitReport); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := strings.Count(junitReport.String(), `timestamp="2018-01-02T03:04:05"`); count != 2 {
+		t.Errorf("Report xml ==\n%s, want 2 test suites with timestamp", junitReport.String())
+	}
+}
+
+func TestCollapsePackages(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name:  "mymod/internal/a",
+				Time:  0.1,
+				Tests: []*parser.Test{{Name: "TestA", Result: parser.PASS}},
+			},
+			{
+				Name:  "mymod/cmd",
+				Time:  0.5,
+				Tests: []*parser.Test{{Name: "TestCmd", Result: parser.PASS}},
+			},
+			{
+				Name:  "mymod/internal/b",
+				Time:  0.2,
+				Tests: []*parser.Test{{Name: "TestB", Result: parser.FAIL}},
+			},
+			{
+				Name:  "mymod/internal/c/d",
+				Time:  0.3,
+				Tests: []*parser.Test{{Name: "TestD", Result: parser.PASS}},
+			},
+		},
+	}
+
+	collapsed := report.CollapsePackages(2)
+
+	if len(collapsed.Packages) != 2 {
+		t.Fatalf("Report packages == %d, want 2", len(collapsed.Packages))
+	}
+
+	pkg := collapsed.Packages[0]
+	if pkg.Name != "mymod/internal" {
+		t.Errorf("Package.Name == %s, want mymod/internal", pkg.Name)
+	}
+	if pkg.Time < 0.6-1e-9 || pkg.Time > 0.6+1e-9 {
+		t.Errorf("Package.Time == %f, want 0.6", pkg.Time)
+	}
+
+	expected := []string{"TestA", "TestB", "TestD"}
+	if len(pkg.Tests) != len(expected) {
+		t.Fatalf("Package Tests == %d, want %d", len(pkg.Tests), len(expected))
+	}
+	for i, test := range pkg.Tests {
+		if test.Name != expected[i] {
+			t.Errorf("Test.Name == %s, want %s", test.Name, expected[i])
+		}
+	}
+
+	if name := collapsed.Packages[1].Name; name != "mymod/cmd" {
+		t.Errorf("Package.Name == %s, want mymod/cmd", name)
+	}
+	if len(report.Packages[0].Tests) != 1 {
+		t.Errorf("original report was modified")
+	}
+}
+
+func TestDurationProperty(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name: "package/name",
+				Tests: []*parser.Test{
+					{Name: "TestPrecise", Time: 1.234567891, Result: parser.PASS},
+				},
+			},
+		},
+	}
+
+	var junitReport bytes.Buffer
+	if err := formatter.JUnitReportXMLWithOptions(report, true, "1.0", formatter.Options{DurationProperty: true}, &junitReport); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<property name="time.ns" value="1234567891"></property>`
+	if !strings.Contains(junitReport.String(), expected) {
+		t.Errorf("Report xml ==\n%s, want test case property\n%s", junitReport.String(), expected)
+	}
+}
+
+func TestTAPFormatter(t *testing.T) {
+	file, err := os.Open("tests/12-go_1_7.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.Parse(file, "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	expected, err := ioutil.ReadFile("tests/12-report.tap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tapReport bytes.Buffer
+	if err := formatter.TAPReport(report, &tapReport); err != nil {
+		t.Fatal(err)
+	}
+
+	if tapReport.String() != string(expected) {
+		t.Errorf("Report tap ==\n%s, want\n%s", tapReport.String(), expected)
+	}
+}
+
+func TestCompareGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-junit-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	golden := dir + "/report.xml"
+	if err := ioutil.WriteFile(golden, []byte("<testsuites>\n\t<testsuite></testsuite>\n</testsuites>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// match
+	diff, err := compareGolden(golden, []byte("<testsuites>\n\t<testsuite></testsuite>\n</testsuites>\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "" {
+		t.Errorf("compareGolden diff ==\n%s, want none", diff)
+	}
+
+	// mismatch
+	generated := []byte("<testsuites>\n\t<testsuite tests=\"1\"></testsuite>\n</testsuites>\n")
+	diff, err = compareGolden(golden, generated, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "2: - \t<testsuite></testsuite>\n2: + \t<testsuite tests=\"1\"></testsuite>\n"
+	if diff != expected {
+		t.Errorf("compareGolden diff ==\n%s, want\n%s", diff, expected)
+	}
+
+	// update
+	diff, err = compareGolden(golden, generated, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "" {
+		t.Errorf("compareGolden diff ==\n%s, want none after update", diff)
+	}
+	contents, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != string(generated) {
+		t.Errorf("golden file ==\n%s, want\n%s", contents, generated)
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	tests := []struct {
+		format       string
+		jsonOutput   bool
+		jsonFlat     bool
+		jsonCoverage bool
+		want         string
+		wantErr      bool
+	}{
+		{"xml", false, false, false, "xml", false},
+		{"json", false, false, false, "json", false},
+		{"tap", false, false, false, "tap", false},
+		{"csv", false, false, false, "csv", false},
+		{"html", false, false, false, "html", false},
+		{"flamegraph-json", false, false, false, "flamegraph-json", false},
+		{"xml", true, false, false, "json", false},
+		{"xml", false, true, false, "json-flat", false},
+		{"xml", false, false, true, "json-coverage", false},
+		{"tap", true, false, false, "tap", false},
+		{"yaml", false, false, false, "", true},
+		{"", false, false, false, "", true},
+	}
+
+	for _, test := range tests {
+		got, err := outputFormat(test.format, test.jsonOutput, test.jsonFlat, test.jsonCoverage)
+		if (err != nil) != test.wantErr {
+			t.Errorf("outputFormat(%q, %v, %v, %v) error = %v, want error %v", test.format, test.jsonOutput, test.jsonFlat, test.jsonCoverage, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Errorf("outputFormat(%q, %v, %v, %v) = %q, want %q", test.format, test.jsonOutput, test.jsonFlat, test.jsonCoverage, got, test.want)
+		}
+	}
+}
+
+func TestEnvProperties(t *testing.T) {
+	os.Setenv("GJR_TEST_RUNNER", "runner <1> & \"2\"")
+	os.Setenv("GJR_TEST_OS", "linux\x1b")
+	defer os.Unsetenv("GJR_TEST_RUNNER")
+	defer os.Unsetenv("GJR_TEST_OS")
+
+	properties := envProperties("GJR_TEST_", os.Environ())
+
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name: "package/name",
+				Tests: []*parser.Test{
+					{
+						Name:   "TestOne",
+						Result: parser.PASS,
+						Output: []string{},
+					},
+				},
+			},
+		},
+	}
+
+	var junitReport bytes.Buffer
+	if err := formatter.JUnitReportXMLWithOptions(report, true, "1.0", formatter.Options{Properties: properties}, &junitReport); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `		<properties>
+			<property name="go.version" value="1.0"></property>
+			<property name="OS" value="linux"></property>
+			<property name="RUNNER" value="runner &lt;1&gt; &amp; &#34;2&#34;"></property>
+		</properties>`
+	if !strings.Contains(junitReport.String(), expected) {
+		t.Errorf("Report xml ==\n%s, want properties\n%s", junitReport.String(), expected)
+	}
+
+	if properties := envProperties("", os.Environ()); properties != nil {
+		t.Errorf("envProperties with empty prefix = %v, want none", properties)
+	}
+}
+
+func TestParseStream(t *testing.T) {
+	for _, testCase := range testCases {
+		if testCase.jsonInput || testCase.options.MergePackages {
+			continue
+		}
+
+		file, err := os.Open("tests/" + testCase.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := parser.ParseWithOptions(file, testCase.packageName, testCase.options)
+		if err != nil {
+			t.Fatalf("error parsing: %s", err)
+		}
+
+		if _, err := file.Seek(0, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		err = parser.ParseStreamWithOptions(file, testCase.packageName, testCase.options, func(p parser.Package) error {
+			names = append(names, p.Name)
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			t.Fatalf("error parsing: %s", err)
+		}
+
+		if len(names) != len(report.Packages) {
+			t.Errorf("%s: emitted %d packages, want %d", testCase.name, len(names), len(report.Packages))
+			continue
+		}
+		for i, name := range names {
+			if name != report.Packages[i].Name {
+				t.Errorf("%s: emitted package %d == %s, want %s", testCase.name, i, name, report.Packages[i].Name)
+			}
+		}
+	}
+
+	file, err := os.Open("tests/31-mixed-verbosity.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	stop := fmt.Errorf("stop")
+	calls := 0
+	err = parser.ParseStream(file, "", func(p parser.Package) error {
+		calls++
+		return stop
+	})
+	if err != stop {
+		t.Errorf("ParseStream error == %v, want %v", err, stop)
+	}
+	if calls != 1 {
+		t.Errorf("emit called %d times, want 1", calls)
+	}
+}
+
+func TestFlaky(t *testing.T) {
+	file, err := os.Open("tests/37-count-reruns.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.Parse(file, "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	want := map[string]bool{"TestFlaky": true, "TestStable": false}
+	for _, test := range report.Packages[0].Tests {
+		if test.Flaky() != want[test.Name] {
+			t.Errorf("%s Flaky() == %v, want %v", test.Name, test.Flaky(), want[test.Name])
+		}
+	}
+}
+
+func TestMultiSink(t *testing.T) {
+	file, err := os.Open("tests/31-mixed-verbosity.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var junitReport, progress bytes.Buffer
+	reportSink := formatter.NewReportSink(func(report *parser.Report) error {
+		return formatter.JUnitReportXML(report, false, "1.0", &junitReport)
+	})
+	sink := formatter.MultiSink(reportSink, &formatter.ProgressSink{W: &progress})
+
+	if err := parser.ParseStream(file, "", sink.WritePackage); err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	report, err := parser.Parse(file, "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+	var expected bytes.Buffer
+	if err := formatter.JUnitReportXML(report, false, "1.0", &expected); err != nil {
+		t.Fatal(err)
+	}
+	if junitReport.String() != expected.String() {
+		t.Errorf("Report xml ==\n%s, want\n%s", junitReport.String(), expected.String())
+	}
+
+	var names []string
+	for _, pkg := range reportSink.Report.Packages {
+		names = append(names, pkg.Name)
+	}
+	lines := strings.Split(strings.TrimSuffix(progress.String(), "\n"), "\n")
+	if len(lines) != len(names) {
+		t.Fatalf("progress lines == %d, want %d\n%s", len(lines), len(names), progress.String())
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, " "+names[i]+" ") {
+			t.Errorf("progress line %d == %q, want package %s", i, line, names[i])
+		}
+	}
+}
+
+func TestResultString(t *testing.T) {
+	tests := []struct {
+		result parser.Result
+		want   string
+	}{
+		{parser.PASS, "PASS"},
+		{parser.FAIL, "FAIL"},
+		{parser.SKIP, "SKIP"},
+		{parser.Result(-1), "UNKNOWN"},
+		{parser.Result(3), "UNKNOWN"},
+	}
+
+	for _, test := range tests {
+		if got := test.result.String(); got != test.want {
+			t.Errorf("Result(%d).String() == %s, want %s", int(test.result), got, test.want)
+		}
+	}
+}
+
+func TestSubtestJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		isSubtest    bool
+		topLevelName string
+	}{
+		{"TestOne", false, "TestOne"},
+		{"TestOne/sub", true, "TestOne"},
+		{"TestOne/sub/nested", true, "TestOne"},
+	}
+
+	for _, test := range tests {
+		data, err := json.Marshal(&parser.Test{Name: test.name, Output: []string{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got struct {
+			Name         string `json:"name"`
+			IsSubtest    bool   `json:"isSubtest"`
+			TopLevelName string `json:"topLevelName"`
+		}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Name != test.name {
+			t.Errorf("name == %s, want %s", got.Name, test.name)
+		}
+		if got.IsSubtest != test.isSubtest {
+			t.Errorf("%s isSubtest == %v, want %v", test.name, got.IsSubtest, test.isSubtest)
+		}
+		if got.TopLevelName != test.topLevelName {
+			t.Errorf("%s topLevelName == %s, want %s", test.name, got.TopLevelName, test.topLevelName)
+		}
+	}
+}
+
+func TestFormatTimePrec(t *testing.T) {
+	tests := []struct {
+		time     float64
+		decimals int
+		want     string
+	}{
+		{1.23456789, 3, "1.235"},
+		{1.23456789, 6, "1.234568"},
+		{0.000001234, 9, "0.000001234"},
+		{12.5, 0, "12"},
+		{12.6, 0, "13"},
+		{12.6, -2, "13"},
+	}
+
+	for _, test := range tests {
+		if got := formatter.FormatTimePrec(test.time, test.decimals); got != test.want {
+			t.Errorf("FormatTimePrec(%v, %d) == %s, want %s", test.time, test.decimals, got, test.want)
+		}
+	}
+
+	if got := formatter.FormatTime(1.23456789); got != "1.235" {
+		t.Errorf("FormatTime(1.23456789) == %s, want 1.235", got)
+	}
+}
+
+func TestMaxFailures(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name: "package/one",
+				Tests: []*parser.Test{
+					{Name: "TestA", Result: parser.FAIL, Output: []string{"a"}},
+					{Name: "TestB", Result: parser.PASS, Output: []string{}},
+					{Name: "TestC", Result: parser.FAIL, Output: []string{"c"}},
+				},
+			},
+			{
+				Name: "package/two",
+				Tests: []*parser.Test{
+					{Name: "TestD", Result: parser.FAIL, Output: []string{"d"}},
+					{Name: "TestE", Result: parser.FAIL, Output: []string{"e"}},
+				},
+			},
+		},
+	}
+
+	var junitReport bytes.Buffer
+	if err := formatter.JUnitReportXMLWithOptions(report, true, "1.0", formatter.Options{MaxFailures: 2}, &junitReport); err != nil {
+		t.Fatal(err)
+	}
+
+	var suites struct {
+		Suites []struct {
+			Name       string                    `xml:"name,attr"`
+			Failures   int                       `xml:"failures,attr"`
+			Properties []formatter.JUnitProperty `xml:"properties>property"`
+			TestCases  []formatter.JUnitTestCase `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(junitReport.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		names    string
+		failures int
+		omitted  string
+	}{
+		{"TestA TestB TestC", 2, ""},
+		{"", 2, "2"},
+	}
+	for i, test := range tests {
+		ts := suites.Suites[i]
+
+		var names []string
+		for _, tc := range ts.TestCases {
+			names = append(names, tc.Name)
+		}
+		if got := strings.Join(names, " "); got != test.names {
+			t.Errorf("%s test cases == %q, want %q", ts.Name, got, test.names)
+		}
+
+		if ts.Failures != test.failures {
+			t.Errorf("%s failures == %d, want %d", ts.Name, ts.Failures, test.failures)
+		}
+
+		omitted := ""
+		for _, p := range ts.Properties {
+			if p.Name == "failures.omitted" {
+				omitted = p.Value
+			}
+		}
+		if omitted != test.omitted {
+			t.Errorf("%s failures.omitted == %q, want %q", ts.Name, omitted, test.omitted)
+		}
+	}
+
+	if report.Failures() != 4 || len(report.Packages[1].Tests) != 2 {
+		t.Errorf("report was changed by the formatter")
+	}
+}
+
+func TestProperties(t *testing.T) {
+	var properties propertyFlags
+	for _, value := range []string{"build=123", "runner=ci=1", "go.version=custom"} {
+		if err := properties.Set(value); err != nil {
+			t.Fatalf("Set(%q) error: %s", value, err)
+		}
+	}
+	for _, value := range []string{"build", "=123"} {
+		if err := properties.Set(value); err == nil {
+			t.Errorf("Set(%q) error == nil, want error", value)
+		}
+	}
+
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name:     "package/local",
+				Tests:    []*parser.Test{},
+				Hostname: "",
+			},
+			{
+				Name:     "package/remote",
+				Tests:    []*parser.Test{},
+				Hostname: "node-1",
+			},
+		},
+	}
+
+	var junitReport bytes.Buffer
+	opts := formatter.Options{Properties: properties, Hostname: "runner-7"}
+	if err := formatter.JUnitReportXMLWithOptions(report, true, "1.0", opts, &junitReport); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<testsuites>
+	<testsuite tests="0" failures="0" skipped="0" time="0.000" name="package/local" hostname="runner-7">
+		<properties>
+			<property name="go.version" value="custom"></property>
+			<property name="build" value="123"></property>
+			<property name="runner" value="ci=1"></property>
+		</properties>
+	</testsuite>
+	<testsuite tests="0" failures="0" skipped="0" time="0.000" name="package/remote" hostname="node-1">
+		<properties>
+			<property name="go.version" value="custom"></property>
+			<property name="build" value="123"></property>
+			<property name="runner" value="ci=1"></property>
+		</properties>
+	</testsuite>
+</testsuites>
+`
+	if junitReport.String() != expected {
+		t.Errorf("Report xml ==\n%s, want\n%s", junitReport.String(), expected)
+	}
+}
+
+func TestCSVFormatter(t *testing.T) {
+	file, err := os.Open("tests/12-go_1_7.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.Parse(file, "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	expected, err := ioutil.ReadFile("tests/12-report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var csvReport bytes.Buffer
+	if err := formatter.CSVReport(report, &csvReport); err != nil {
+		t.Fatal(err)
+	}
+
+	if csvReport.String() != string(expected) {
+		t.Errorf("Report csv ==\n%s, want\n%s", csvReport.String(), expected)
+	}
+}
+
+func TestFlameGraphFormatter(t *testing.T) {
+	file, err := os.Open("tests/46-flamegraph.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.Parse(file, "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	expected, err := ioutil.ReadFile("tests/46-report.flamegraph.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var flameGraph bytes.Buffer
+	if err := formatter.FlameGraphReport(report, &flameGraph); err != nil {
+		t.Fatal(err)
+	}
+
+	if flameGraph.String() != string(expected) {
+		t.Errorf("Report flame graph ==\n%s, want\n%s", flameGraph.String(), expected)
+	}
+}
+
+func TestSuitesTotals(t *testing.T) {
+	file, err := os.Open("tests/12-go_1_7.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.Parse(file, "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	var junitReport bytes.Buffer
+	if err := formatter.JUnitReportXMLWithOptions(report, true, "1.0", formatter.Options{SuitesTotals: true}, &junitReport); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<testsuites tests="18" failures="3" errors="0" skipped="2" time="0.050">`
+	if !strings.HasPrefix(junitReport.String(), expected+"\n") {
+		t.Errorf("Report xml ==\n%s, want root element\n%s", junitReport.String(), expected)
+	}
+
+	junitReport.Reset()
+	if err := formatter.JUnitReportXMLWithOptions(report, true, "1.0", formatter.Options{}, &junitReport); err != nil {
+		t.Fatal(err)
+	}
+	// the totals are only written with SuitesTotals
+	if expected := `<testsuites>`; !strings.HasPrefix(junitReport.String(), expected+"\n") {
+		t.Errorf("Report xml ==\n%s, want root element\n%s", junitReport.String(), expected)
+	}
+}
+
+func TestServe(t *testing.T) {
+	input, err := ioutil.ReadFile("tests/01-pass.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(r io.Reader) (*parser.Report, error) {
+		return parser.Parse(r, "")
+	}
+	server := httptest.NewServer(reportHandler(read, "1.0", formatter.Options{}))
+	defer server.Close()
+
+	post := func(accept string, body []byte) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := post("", input)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST status == %d, want %d: %s", resp.StatusCode, http.StatusOK, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/xml" {
+		t.Errorf("Content-Type == %q, want %q", ct, "application/xml")
+	}
+	if !strings.Contains(string(body), `<testsuite tests="2" failures="0"`) {
+		t.Errorf("Report xml ==\n%s, want testsuite with 2 tests", body)
+	}
+
+	resp = post("image/png, application/json;q=0.9", input)
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type == %q, want %q", ct, "application/json")
+	}
+	var report parser.Report
+	if err := json.Unmarshal(body, &report); err != nil {
+		t.Fatalf("error unmarshalling json: %s\n%s", err, body)
+	}
+	if len(report.Packages) != 1 || len(report.Packages[0].Tests) != 2 {
+		t.Errorf("Report json ==\n%s, want 1 package with 2 tests", body)
+	}
+
+	resp = post("application/json;q=0.1, application/xml", input)
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/xml" {
+		t.Errorf("Content-Type with lower json quality == %q, want %q", ct, "application/xml")
+	}
+
+	resp = post("image/png", input)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotAcceptable {
+		t.Errorf("Accept image/png status == %d, want %d", resp.StatusCode, http.StatusNotAcceptable)
+	}
+
+	resp = post("", bytes.Repeat([]byte("ok  \tpackage/name 0.1s\n"), maxRequestSize/20))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized POST status == %d, want %d", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+
+	resp, err = http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET status == %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	for _, testCase := range testCases {
+		if testCase.jsonInput || !reflect.DeepEqual(testCase.options, parser.Options{}) {
+			continue
+		}
+
+		content, err := ioutil.ReadFile("tests/" + testCase.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected, err := parser.Parse(bytes.NewReader(content), testCase.packageName)
+		if err != nil {
+			t.Fatalf("error parsing: %s", err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+		report, err := parser.ParseLines(lines, testCase.packageName)
+		if err != nil {
+			t.Fatalf("error parsing lines: %s", err)
+		}
+
+		if !reflect.DeepEqual(report, expected) {
+			t.Errorf("%s: ParseLines report differs from Parse report", testCase.name)
+		}
+	}
+}
+
+func TestHTMLFormatter(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name:        "package/name",
+				Time:        0.16,
+				CoveragePct: "25.00",
+				Tests: []*parser.Test{
+					{Name: "TestOne", Time: 0.06, Result: parser.PASS, Output: []string{"passing <output>"}},
+					{Name: "TestTwo", Time: 0.1, Result: parser.FAIL, Output: []string{"want <b>1</b>", "got & 2"}},
+				},
+			},
+			{
+				Name:        "package/other",
+				CoveragePct: "75.00",
+				Tests: []*parser.Test{
+					{Name: "TestThree", Result: parser.SKIP, Output: []string{}},
+				},
+			},
+		},
+	}
+
+	var htmlReport bytes.Buffer
+	if err := formatter.HTMLReport(report, &htmlReport); err != nil {
+		t.Fatal(err)
+	}
+
+	html := htmlReport.String()
+	for _, want := range []string{
+		"<p>Total: 3, passed: 1, failed: 1, skipped: 1, coverage: 50.0%</p>",
+		"<details open>\n<summary>package/name (2 tests, 0.160s, coverage: 25.00%)</summary>",
+		`<tr class="pass"><td>TestOne</td><td>PASS</td><td>0.060</td></tr>`,
+		`<tr class="fail"><td>TestTwo</td><td>FAIL</td><td>0.100</td></tr>`,
+		"<pre>want &lt;b&gt;1&lt;/b&gt;\ngot &amp; 2</pre>",
+		"<details>\n<summary>package/other (1 tests, 0.000s, coverage: 75.00%)</summary>",
+		`<tr class="skip"><td>TestThree</td><td>SKIP</td><td>0.000</td></tr>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Report html ==\n%s, want it to contain\n%s", html, want)
+		}
+	}
+	if strings.Contains(html, "passing") {
+		t.Errorf("Report html ==\n%s, want no output of passed tests", html)
+	}
+
+	// the total coverage is preferred over the mean of the packages
+	report.TotalCoverage = "62.50"
+	htmlReport.Reset()
+	if err := formatter.HTMLReport(report, &htmlReport); err != nil {
+		t.Fatal(err)
+	}
+	if want := "coverage: 62.5%</p>"; !strings.Contains(htmlReport.String(), want) {
+		t.Errorf("Report html ==\n%s, want it to contain\n%s", htmlReport.String(), want)
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	expected := "go-junit-report dev " + runtime.Version()
+	if v := versionString(); v != expected {
+		t.Errorf("versionString() == %q, want %q", v, expected)
+	}
+}
+
+func TestDefaultGoVersion(t *testing.T) {
+	version := formatter.DefaultGoVersion()
+	if strings.HasPrefix(version, "go") || !strings.HasSuffix(runtime.Version(), version) {
+		t.Errorf("DefaultGoVersion() == %q, want %q without go prefix", version, runtime.Version())
+	}
+}
+
+func TestTerraformTimings(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name: "package/terraform",
+				Tests: []*parser.Test{
+					{Name: "TestAccResource", Time: 45, CreationTime: 30, DestroyTime: 15, Result: parser.PASS},
+					{Name: "TestAccEstimated", Time: 20, CreationTime: 20, TimesEstimated: true, Result: parser.PASS},
+					{Name: "TestUnit", Result: parser.PASS},
+				},
+			},
+		},
+	}
+
+	var junitReport bytes.Buffer
+	if err := formatter.JUnitReportXMLWithOptions(report, true, "1.0", formatter.Options{TerraformTimings: true}, &junitReport); err != nil {
+		t.Fatal(err)
+	}
+
+	var suites struct {
+		Suites []struct {
+			TestCases []struct {
+				Name       string                    `xml:"name,attr"`
+				Properties formatter.JUnitProperties `xml:"properties"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(junitReport.Bytes(), &suites); err != nil {
+		t.Fatalf("error unmarshalling xml: %s", err)
+	}
+
+	expected := map[string][]formatter.JUnitProperty{
+		"TestAccResource": {
+			{Name: "tf.creation_time", Value: "30.000"},
+			{Name: "tf.destroy_time", Value: "15.000"},
+		},
+		"TestAccEstimated": {
+			{Name: "tf.creation_time", Value: "20.000"},
+			{Name: "tf.times_estimated", Value: "true"},
+		},
+		"TestUnit": nil,
+	}
+	for _, testCase := range suites.Suites[0].TestCases {
+		if !reflect.DeepEqual(testCase.Properties.Properties, expected[testCase.Name]) {
+			t.Errorf("%s properties == %v, want %v", testCase.Name, testCase.Properties.Properties, expected[testCase.Name])
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	test := &parser.Test{Time: 1.234567891}
+	if d := test.Duration(); d != 1234567891*time.Nanosecond {
+		t.Errorf("Test.Duration() == %s, want %s", d, 1234567891*time.Nanosecond)
+	}
+
+	pkg := &parser.Package{Time: 0.16}
+	if d := pkg.Duration(); d != 160*time.Millisecond {
+		t.Errorf("Package.Duration() == %s, want %s", d, 160*time.Millisecond)
+	}
+}
+
+func TestJSONIndent(t *testing.T) {
+	file, err := os.Open("tests/10-multipkg-coverage.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.Parse(file, "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	var indented bytes.Buffer
+	if err := formatter.JSONReportIndent(report, &indented); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(indented.String(), "{\n  \"schemaVersion\": 1,\n  \"goVersion\": ") {
+		t.Errorf("Report json ==\n%s, want it indented with two spaces", indented.String())
+	}
+
+	var compact bytes.Buffer
+	if err := formatter.JSONReport(report, &compact); err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if err := json.Compact(&want, indented.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if want.String()+"\n" != compact.String() {
+		t.Errorf("compacted indented json ==\n%s, want\n%s", want.String(), compact.String())
+	}
+
+	// packages and tests keep the order of the go test output
+	var decoded parser.Report
+	if err := json.Unmarshal(indented.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	var names, expected []string
+	for _, pkg := range decoded.Packages {
+		names = append(names, pkg.Name)
+		for _, test := range pkg.Tests {
+			names = append(names, pkg.Name+"."+test.Name)
+		}
+	}
+	for _, pkg := range report.Packages {
+		expected = append(expected, pkg.Name)
+		for _, test := range pkg.Tests {
+			expected = append(expected, pkg.Name+"."+test.Name)
+		}
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("JSON order == %v, want %v", names, expected)
+	}
+}
+
+func TestResultFilter(t *testing.T) {
+	file, err := os.Open("tests/12-go_1_7.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.Parse(file, "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	tests := []struct {
+		only     string
+		failures int
+		skipped  int
+		total    int
+	}{
+		{"failures", 3, 0, 3},
+		{"skips", 0, 2, 2},
+	}
+	for _, test := range tests {
+		keep, err := resultFilter(test.only)
+		if err != nil {
+			t.Fatalf("resultFilter(%q) error = %s", test.only, err)
+		}
+
+		filtered := report.Filter(keep)
+		if filtered.Failures() != test.failures || filtered.Skipped() != test.skipped || filtered.Total() != test.total {
+			t.Errorf("-only %s: failures, skipped, total == %d, %d, %d, want %d, %d, %d", test.only,
+				filtered.Failures(), filtered.Skipped(), filtered.Total(), test.failures, test.skipped, test.total)
+		}
+		for _, pkg := range filtered.Packages {
+			if len(pkg.Tests) == 0 {
+				t.Errorf("-only %s: package %s has no tests, want it dropped", test.only, pkg.Name)
+			}
+		}
+	}
+
+	if keep, err := resultFilter("all"); keep != nil || err != nil {
+		t.Errorf("resultFilter(\"all\") == %v, %v, want nil, nil", keep != nil, err)
+	}
+	if _, err := resultFilter("passes"); err == nil {
+		t.Errorf("resultFilter(\"passes\") error = nil, want error")
+	}
+}
+
+func TestFailureMessage(t *testing.T) {
+	tests := []struct {
+		output  []string
+		message string
+	}{
+		{[]string{}, "Failed"},
+		{[]string{"", "  "}, "Failed"},
+		{[]string{"", "file_test.go:10: want 1, got 2", "", "more details"}, "file_test.go:10: want 1, got 2"},
+		{[]string{"file_test.go:10: Error Trace:", "    Error: not equal"}, "file_test.go:10: Error Trace: Error: not equal"},
+		{[]string{"    file_test.go:10: want 1,", "        got 2", "    file_test.go:11: second error"}, "file_test.go:10: want 1, got 2"},
+		{[]string{"got:", "a", "", "b", "want:", "a", "b", ""}, "got:\na\n\nb\nwant:\na\nb"},
+	}
+
+	for _, test := range tests {
+		report := &parser.Report{
+			Packages: []parser.Package{
+				{
+					Name: "package/name",
+					Tests: []*parser.Test{
+						{Name: "TestFail", Result: parser.FAIL, Output: test.output},
+					},
+				},
+			},
+		}
+
+		var junitReport bytes.Buffer
+		if err := formatter.JUnitReportXML(report, true, "1.0", &junitReport); err != nil {
+			t.Fatal(err)
+		}
+
+		var suites struct {
+			Suites []struct {
+				TestCases []struct {
+					Failure struct {
+						Message  string `xml:"message,attr"`
+						Contents string `xml:",chardata"`
+					} `xml:"failure"`
+				} `xml:"testcase"`
+			} `xml:"testsuite"`
+		}
+		if err := xml.Unmarshal(junitReport.Bytes(), &suites); err != nil {
+			t.Fatalf("error unmarshalling xml: %s", err)
+		}
+
+		failure := suites.Suites[0].TestCases[0].Failure
+		if failure.Message != test.message {
+			t.Errorf("failure message for %q == %q, want %q", test.output, failure.Message, test.message)
+		}
+		if contents := strings.Join(test.output, "\n"); failure.Contents != contents {
+			t.Errorf("failure contents for %q == %q, want %q", test.output, failure.Contents, contents)
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	f := &follower{}
+	f.add(parser.Package{Name: "package/one", Tests: []*parser.Test{{Name: "TestOne", Result: parser.PASS}}})
+
+	reports := make(chan *parser.Report, 1)
+	stop := make(chan struct{})
+	done := f.follow(time.Millisecond, func(report *parser.Report) error {
+		select {
+		case reports <- report:
+		default:
+		}
+		return nil
+	}, stop)
+
+	partial := <-reports
+	close(stop)
+	<-done
+
+	if len(partial.Packages) != 1 || partial.Packages[0].Name != "package/one" {
+		t.Errorf("partial report packages == %v, want package/one", partial.Packages)
+	}
+
+	// packages added later are only in later reports
+	f.add(parser.Package{Name: "package/two"})
+	if len(partial.Packages) != 1 {
+		t.Errorf("partial report packages == %d after adding a package, want 1", len(partial.Packages))
+	}
+	if n := len(f.report().Packages); n != 2 {
+		t.Errorf("report packages == %d, want 2", n)
+	}
+}
+
+func TestReadJSONReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-junit-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name:        "package/name",
+				CoveragePct: "50.0",
+				Tests: []*parser.Test{
+					{Name: "TestOne", Result: parser.FAIL},
+					{Name: "TestOne/Sub", Result: parser.FAIL, Parent: "TestOne"},
+					{Name: "TestTwo", Result: parser.PASS},
+				},
+			},
+		},
+	}
+
+	writers := map[string]func(io.Writer) error{
+		"json": func(w io.Writer) error {
+			return formatter.JSONReport(report, w)
+		},
+		"json-nested": func(w io.Writer) error {
+			return formatter.JSONReportWithOptions(report, "", formatter.Options{JSONNested: true}, w)
+		},
+		"json-coverage": func(w io.Writer) error {
+			return formatter.JSONCoverageReport(report, "set", w)
+		},
+	}
+	for name, write := range writers {
+		path := dir + "/" + name + ".json"
+		if err := writeFile(path, write); err != nil {
+			t.Fatal(err)
+		}
+
+		read, err := readJSONReport(path)
+		if err != nil {
+			t.Errorf("reading %s report: %s", name, err)
+			continue
+		}
+		if len(read.Packages) != 1 {
+			t.Errorf("%s report packages == %d, want 1", name, len(read.Packages))
+			continue
+		}
+
+		pkg := read.Packages[0]
+		var names []string
+		for _, test := range pkg.Tests {
+			names = append(names, test.Name)
+		}
+		if expected := []string{"TestOne", "TestOne/Sub", "TestTwo"}; !reflect.DeepEqual(names, expected) {
+			t.Errorf("%s report tests == %v, want %v", name, names, expected)
+		}
+		if pkg.Tests[1].Result != parser.FAIL {
+			t.Errorf("%s report result of TestOne/Sub == %s, want FAIL", name, pkg.Tests[1].Result)
+		}
+		if pkg.CoveragePct != "50.0" {
+			t.Errorf("%s report coverage == %q, want %q", name, pkg.CoveragePct, "50.0")
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-junit-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := dir + "/report.xml"
+	for _, contents := range []string{"partial", "complete"} {
+		err := writeFile(path, func(w io.Writer) error {
+			_, err := io.WriteString(w, contents)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		written, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != contents {
+			t.Errorf("file contents == %q, want %q", written, contents)
+		}
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file exists after writing, stat error = %v", err)
+	}
+}
+
+func TestAllTests(t *testing.T) {
+	file, err := os.Open("tests/10-multipkg-coverage.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.Parse(file, "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	var names []string
+	for _, test := range report.AllTests() {
+		names = append(names, test.Package+"."+test.Name)
+	}
+	expected := []string{"package1/foo.TestA", "package1/foo.TestB", "package2/bar.TestC"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("AllTests() == %v, want %v", names, expected)
+	}
+
+	// the tests are returned unchanged
+	report = &parser.Report{
+		Packages: []parser.Package{
+			{Name: "package/name", Tests: []*parser.Test{{Name: "TestOne"}}},
+		},
+	}
+	if pkg := report.AllTests()[0].Package; pkg != "" {
+		t.Errorf("AllTests()[0].Package == %q, want %q", pkg, "")
+	}
+}
+
+func TestClassname(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{Name: "package/name", Tests: []*parser.Test{{Name: "TestOne"}}},
+			{Name: "", Tests: []*parser.Test{{Name: "TestTwo"}}},
+		},
+	}
+
+	var junitReport bytes.Buffer
+	if err := formatter.JUnitReportXMLWithOptions(report, true, "1.0", formatter.Options{PackageName: "compiled/name"}, &junitReport); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`<testcase classname="package/name" name="TestOne"`,
+		`<testcase classname="compiled/name" name="TestTwo"`,
+	} {
+		if !strings.Contains(junitReport.String(), expected) {
+			t.Errorf("Report xml ==\n%s, want test case\n%s", junitReport.String(), expected)
+		}
+	}
+}
+
+func TestJSONDocument(t *testing.T) {
+	file, err := os.Open("tests/10-multipkg-coverage.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.Parse(file, "")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+	report.Packages[0].Tests[1].Result = parser.FAIL
+	report.Packages[1].Tests[0].Result = parser.SKIP
+
+	var jsonReport bytes.Buffer
+	timestamp := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := formatter.JSONReportWithOptions(report, "1.0", formatter.Options{Timestamp: timestamp}, &jsonReport); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc formatter.JSONDocument
+	if err := json.Unmarshal(jsonReport.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %s\n%s", err, jsonReport.String())
+	}
+	packages := doc.Packages
+	doc.Packages = nil
+
+	expected := formatter.JSONDocument{
+		SchemaVersion: formatter.JSONSchemaVersion,
+		GeneratedAt:   "2018-01-02T03:04:05Z",
+		GoVersion:     "1.0",
+		Tests:         3,
+		Passed:        1,
+		Failed:        1,
+		Skipped:       1,
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("JSON document == %+v, want %+v", doc, expected)
+	}
+	if len(packages) != 2 {
+		t.Errorf("JSON document packages == %d, want 2", len(packages))
+	}
+
+	// the document is still read as a report, e.g. by -diff
+	var read parser.Report
+	if err := json.Unmarshal(jsonReport.Bytes(), &read); err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Packages) != 2 || read.Packages[1].Name != "package2/bar" {
+		t.Errorf("read packages == %+v, want package1/foo and package2/bar", read.Packages)
+	}
+}
+
+func TestKeepColor(t *testing.T) {
+	file, err := os.Open("tests/56-color.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.ParseWithOptions(file, "", parser.Options{KeepColor: true})
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	if len(report.Packages) != 1 || len(report.Packages[0].Tests) != 2 {
+		t.Fatalf("report == %+v, want package/color with 2 tests", report)
+	}
+	test := report.Packages[0].Tests[1]
+	if test.Result != parser.FAIL {
+		t.Errorf("Test.Result == %s, want %s", test.Result, parser.FAIL)
+	}
+	expected := []string{"two_test.go:9: \x1b[31mgot 1, want 2\x1b[0m"}
+	if !reflect.DeepEqual(test.Output, expected) {
+		t.Errorf("Test.Output == %q, want %q", test.Output, expected)
+	}
+}
+
+func TestSlowTests(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name: "package/one",
+				Tests: []*parser.Test{
+					{Name: "TestFast", Time: 0.1},
+					{Name: "TestSlow", Time: 2},
+				},
+			},
+			{
+				Name: "package/two",
+				Tests: []*parser.Test{
+					{Name: "TestSlowest", Time: 5},
+					{Name: "TestThreshold", Time: 1},
+				},
+			},
+		},
+	}
+
+	var names []string
+	for _, test := range report.SlowTests(1) {
+		names = append(names, test.Name)
+	}
+	expected := []string{"TestSlowest", "TestSlow"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("SlowTests(1) == %v, want %v", names, expected)
+	}
+
+	report.MarkSlow(1)
+	for _, test := range report.AllTests() {
+		if want := test.Time > 1; test.Slow != want {
+			t.Errorf("%s Slow == %v, want %v", test.Name, test.Slow, want)
+		}
+	}
+
+	var junitReport bytes.Buffer
+	if err := formatter.JUnitReportXML(report, true, "1.0", &junitReport); err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(junitReport.String(), `<property name="slow" value="true"></property>`); count != 2 {
+		t.Errorf("Report xml ==\n%s, want 2 test cases with slow property", junitReport.String())
+	}
+}
+
+func TestJSONNested(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name: "package/name",
+				Tests: []*parser.Test{
+					{Name: "TestOne", Result: parser.FAIL, Output: []string{}},
+					{Name: "TestOne/sub", Parent: "TestOne", Result: parser.PASS, Output: []string{}},
+					{Name: "TestOne/sub/nested", Parent: "TestOne/sub", Time: 0.5, Result: parser.PASS, Output: []string{"ok"}},
+					{Name: "TestOne/other", Parent: "TestOne", Result: parser.FAIL, Output: []string{}},
+					{Name: "TestTwo", Result: parser.PASS, Output: []string{}},
+				},
+			},
+		},
+	}
+
+	var jsonReport bytes.Buffer
+	if err := formatter.JSONReportWithOptions(report, "1.0", formatter.Options{JSONNested: true}, &jsonReport); err != nil {
+		t.Fatal(err)
+	}
+
+	type test struct {
+		Name     string   `json:"name"`
+		Time     float64  `json:"time"`
+		Output   []string `json:"output"`
+		Subtests []test   `json:"subtests"`
+	}
+	var doc struct {
+		SchemaVersion int `json:"schemaVersion"`
+		Packages      []struct {
+			Name  string `json:"name"`
+			Tests []test `json:"tests"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal(jsonReport.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %s\n%s", err, jsonReport.String())
+	}
+
+	expected := []test{
+		{
+			Name:   "TestOne",
+			Output: []string{},
+			Subtests: []test{
+				{
+					Name:   "TestOne/sub",
+					Output: []string{},
+					Subtests: []test{
+						{Name: "TestOne/sub/nested", Time: 0.5, Output: []string{"ok"}, Subtests: []test{}},
+					},
+				},
+				{Name: "TestOne/other", Output: []string{}, Subtests: []test{}},
+			},
+		},
+		{Name: "TestTwo", Output: []string{}, Subtests: []test{}},
+	}
+	if doc.SchemaVersion != formatter.JSONSchemaVersion || len(doc.Packages) != 1 {
+		t.Fatalf("JSON document ==\n%s, want schema version and 1 package", jsonReport.String())
+	}
+	if !reflect.DeepEqual(doc.Packages[0].Tests, expected) {
+		t.Errorf("nested tests == %+v, want %+v", doc.Packages[0].Tests, expected)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		line string
+		want *parser.Summary
+	}{
+		{"DONE 42 tests in 1.234s", &parser.Summary{Tests: 42, Time: 1.234}},
+		{"DONE 1 test, 1 failure in 0.1s", &parser.Summary{Tests: 1, Failures: 1, Time: 0.1}},
+		{"DONE 42 tests, 3 skipped, 2 failures, 1 error in 1m2.5s", &parser.Summary{Tests: 42, Skipped: 3, Failures: 2, Errors: 1, Time: 62.5}},
+		{"DONE 2 runs, 44 tests, 1 failure in 3s", &parser.Summary{Tests: 44, Failures: 1, Time: 3}},
+		{"DONE", nil},
+	}
+
+	for _, test := range tests {
+		report, err := parser.ParseLines([]string{test.line}, "")
+		if err != nil {
+			t.Fatalf("error parsing: %s", err)
+		}
+		if !reflect.DeepEqual(report.Summary, test.want) {
+			t.Errorf("Summary of %q == %+v, want %+v", test.line, report.Summary, test.want)
+		}
+	}
+}
+
+func TestStrict(t *testing.T) {
+	file, err := os.Open("tests/01-pass.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := parser.ParseWithOptions(file, "", parser.Options{Strict: true}); err != nil {
+		t.Errorf("strict parsing of 01-pass.txt: %s", err)
+	}
+
+	input := strings.Join([]string{
+		"=== RUN   TestOne",
+		"    one_test.go:3: indented output",
+		"~~~ PASS: TestOne (0.10s)",
+		"",
+		"PASS",
+		"ok  \tpackage/name\t0.100s",
+		"??? new\tformat",
+	}, "\n")
+
+	_, err = parser.ParseWithOptions(strings.NewReader(input), "", parser.Options{Strict: true})
+	unrecognized, ok := err.(*parser.UnrecognizedError)
+	if !ok {
+		t.Fatalf("strict parsing error == %v, want UnrecognizedError", err)
+	}
+	expected := []parser.UnrecognizedLine{
+		{Number: 3, Text: "~~~ PASS: TestOne (0.10s)"},
+		{Number: 7, Text: "??? new\tformat"},
+	}
+	if unrecognized.Count != 2 || !reflect.DeepEqual(unrecognized.Lines, expected) {
+		t.Errorf("UnrecognizedError == %+v, want lines %+v", unrecognized, expected)
+	}
+	if msg := "2 unrecognized lines\n  line 3: ~~~ PASS: TestOne (0.10s)\n  line 7: ??? new\tformat"; err.Error() != msg {
+		t.Errorf("Error() == %q, want %q", err.Error(), msg)
+	}
+
+	if _, err := parser.ParseWithOptions(strings.NewReader(input), "", parser.Options{Strict: true, MaxUnrecognized: 2}); err != nil {
+		t.Errorf("strict parsing with MaxUnrecognized 2: %s", err)
+	}
+	if _, err := parser.ParseWithOptions(strings.NewReader(input), "", parser.Options{}); err != nil {
+		t.Errorf("lenient parsing: %s", err)
+	}
+}
+
+func TestExampleOutput(t *testing.T) {
+	input := strings.Join([]string{
+		"=== RUN   ExampleBye",
+		"--- FAIL: ExampleBye (0.00s)",
+		"got:",
+		"hello",
+		"=== RUN   ExampleHello",
+		"--- PASS: ExampleHello (0.00s)",
+		"unindented output",
+		"=== RUN   TestHello",
+		"--- PASS: TestHello (0.00s)",
+		"FAIL",
+		"FAIL\tpackage/examples\t0.003s",
+	}, "\n")
+
+	report, err := parser.Parse(strings.NewReader(input), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := report.Packages[0].Tests
+	if expected := []string{"got:", "hello"}; !reflect.DeepEqual(tests[0].Output, expected) {
+		t.Errorf("Output of failed example == %q, want %q", tests[0].Output, expected)
+	}
+	if len(tests[1].Output) != 0 {
+		t.Errorf("Output of passed example == %q, want none", tests[1].Output)
+	}
+	if expected := []string{"unindented output"}; !reflect.DeepEqual(tests[2].Output, expected) {
+		t.Errorf("Output of test after passed example == %q, want %q", tests[2].Output, expected)
+	}
+}
+
+func TestStats(t *testing.T) {
+	input := strings.Join([]string{
+		"=== RUN   TestOne",
+		"--- PASS: TestOne (0.10s)",
+		"=== RUN   TestTwo",
+		"??? new format",
+		"--- FAIL: TestTwo (0.20s)",
+		"FAIL",
+		"coverage: 50.0% of statements",
+		"FAIL\tpackage/name\t0.300s",
+	}, "\n")
+
+	var stats parser.Stats
+	if _, err := parser.ParseWithOptions(strings.NewReader(input), "", parser.Options{Stats: &stats}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := parser.Stats{
+		Lines:             8,
+		Results:           1,
+		Statuses:          2,
+		Coverage:          1,
+		Unrecognized:      1,
+		UnrecognizedLines: []parser.UnrecognizedLine{{Number: 4, Text: "??? new format"}},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Stats == %+v, want %+v", stats, expected)
+	}
+}
+
+func TestExclusiveTime(t *testing.T) {
+	file, err := os.Open("tests/59-subtest-time.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := parser.Parse(file, "package/compiled")
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+
+	var junitReport bytes.Buffer
+	if err := formatter.JUnitReportXMLWithOptions(report, true, "1.0", formatter.Options{ExclusiveTime: true}, &junitReport); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`name="TestA" time="0.050"`,
+		`name="TestA/b" time="0.100"`,
+		`name="TestA/b/c" time="0.100"`,
+		`name="TestA/d" time="0.150"`,
+		`name="TestE" time="0.050"`,
+	} {
+		if !strings.Contains(junitReport.String(), expected) {
+			t.Errorf("Report xml ==\n%s, want test case with %s", junitReport.String(), expected)
+		}
+	}
+}
+
+func TestMaxOutputLines(t *testing.T) {
+	var output []string
+	for i := 1; i <= 10; i++ {
+		output = append(output, fmt.Sprintf("line %d", i))
+	}
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name:  "package/name",
+				Setup: output,
+				Tests: []*parser.Test{
+					{Name: "TestLong", Result: parser.FAIL, Output: output},
+					{Name: "TestShort", Result: parser.FAIL, Output: output[:4]},
+				},
+			},
+		},
+	}
+
+	var junitReport bytes.Buffer
+	if err := formatter.JUnitReportXMLWithOptions(report, true, "1.0", formatter.Options{MaxOutputLines: 2}, &junitReport); err != nil {
+		t.Fatal(err)
+	}
+
+	var suites struct {
+		TestCases []struct {
+			Failure   string `xml:"failure"`
+			SystemOut string `xml:"system-out"`
+		} `xml:"testsuite>testcase"`
+		SystemOut string `xml:"testsuite>system-out"`
+	}
+	if err := xml.Unmarshal(junitReport.Bytes(), &suites); err != nil {
+		t.Fatalf("invalid xml: %s", err)
+	}
+	if len(suites.TestCases) != 2 {
+		t.Fatalf("Report xml ==\n%s, want 2 test cases", junitReport.String())
+	}
+
+	expected := "line 1\nline 2\n... (6 lines omitted) ...\nline 9\nline 10"
+	if got := suites.TestCases[0].Failure; got != expected {
+		t.Errorf("Failure == %q, want %q", got, expected)
+	}
+	if got := suites.SystemOut; got != expected {
+		t.Errorf("suite SystemOut == %q, want %q", got, expected)
+	}
+	if got := suites.TestCases[0].SystemOut; got != "" {
+		t.Errorf("SystemOut == %q, want output only in the failure", got)
+	}
+	if got, want := suites.TestCases[1].Failure, strings.Join(output[:4], "\n"); got != want {
+		t.Errorf("Failure == %q, want %q", got, want)
+	}
+
+	// the report itself is not changed
+	if len(report.Packages[0].Tests[0].Output) != 10 {
+		t.Errorf("Output == %q, want 10 lines", report.Packages[0].Tests[0].Output)
+	}
+}
+
+func TestSkipMessage(t *testing.T) {
+	report := &parser.Report{
+		Packages: []parser.Package{
+			{
+				Name: "package/name",
+				Tests: []*parser.Test{
+					{
+						Name:       "TestReason",
+						Result:     parser.SKIP,
+						Output:     []string{"setup done", "skip_test.go:3: not supported"},
+						SkipReason: "skip_test.go:3: not supported",
+					},
+					{
+						Name:   "TestNoReason",
+						Result: parser.SKIP,
+						Output: []string{"first", "second"},
+					},
+				},
+			},
+		},
+	}
+
+	var junitReport bytes.Buffer
+	if err := formatter.JUnitReportXML(report, true, "1.0", &junitReport); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`<skipped message="skip_test.go:3: not supported"></skipped>`,
+		`<system-out>setup done</system-out>`,
+		`<skipped message="first&#xA;second"></skipped>`,
+	} {
+		if !strings.Contains(junitReport.String(), expected) {
+			t.Errorf("Report xml ==\n%s, want %s", junitReport.String(), expected)
+		}
+	}
 }
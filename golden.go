@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// maxGoldenDiffLines is the maximum number of differing lines shown by
+// compareGolden.
+const maxGoldenDiffLines = 10
+
+// compareGolden compares the generated report with the contents of the golden
+// file at path. It returns an empty string if they match, otherwise a
+// description of the differing lines. If update is set, the golden file is
+// replaced by the generated report instead and no differences are returned.
+func compareGolden(path string, generated []byte, update bool) (string, error) {
+	if update {
+		return "", ioutil.WriteFile(path, generated, 0644)
+	}
+
+	golden, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	if bytes.Equal(golden, generated) {
+		return "", nil
+	}
+
+	return diffLines(string(golden), string(generated)), nil
+}
+
+// diffLines returns the lines that differ between want and got, prefixed with
+// their line number.
+func diffLines(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+
+	n := len(wantLines)
+	if len(gotLines) > n {
+		n = len(gotLines)
+	}
+
+	var diff bytes.Buffer
+	shown := 0
+	for i := 0; i < n; i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w == g {
+			continue
+		}
+
+		if shown == maxGoldenDiffLines {
+			fmt.Fprintf(&diff, "...\n")
+			break
+		}
+		shown++
+
+		if i < len(wantLines) {
+			fmt.Fprintf(&diff, "%d: - %s\n", i+1, w)
+		}
+		if i < len(gotLines) {
+			fmt.Fprintf(&diff, "%d: + %s\n", i+1, g)
+		}
+	}
+
+	return diff.String()
+}
+
+// checkGolden compares or updates the golden file with the generated report
+// and exits with status 1 if they differ.
+func checkGolden(path string, generated []byte, update bool) {
+	diff, err := compareGolden(path, generated, update)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error comparing golden file: %s\n", err)
+		os.Exit(1)
+	}
+	if diff != "" {
+		fmt.Fprintf(os.Stderr, "Report differs from golden file %s (- golden, + generated):\n%s", path, diff)
+		os.Exit(1)
+	}
+}
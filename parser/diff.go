@@ -0,0 +1,117 @@
+package parser
+
+// TestID identifies a test by its package and name.
+type TestID struct {
+	Package string `json:"package"`
+	Name    string `json:"name"`
+}
+
+// ReportDiff contains the differences between the test results of two
+// reports.
+type ReportDiff struct {
+	// NewFailures are tests that failed in head, but did not fail or did not
+	// exist in base.
+	NewFailures []TestID `json:"newFailures"`
+	// Fixed are tests that failed in base and no longer fail in head.
+	Fixed []TestID `json:"fixed"`
+	// Added are tests that exist in head, but not in base.
+	Added []TestID `json:"added"`
+	// Removed are tests that exist in base, but not in head.
+	Removed []TestID `json:"removed"`
+}
+
+// Diff compares the test results of head against those of base. Tests are
+// matched by package and name, when a name is repeated within a package the
+// last result is used.
+func Diff(base, head *Report) ReportDiff {
+	diff := ReportDiff{
+		NewFailures: []TestID{},
+		Fixed:       []TestID{},
+		Added:       []TestID{},
+		Removed:     []TestID{},
+	}
+
+	baseResults := testResults(base)
+	headResults := testResults(head)
+
+	for _, id := range testIDs(head) {
+		baseResult, inBase := baseResults[id]
+		if !inBase {
+			diff.Added = append(diff.Added, id)
+		}
+		if headResults[id] == FAIL && (!inBase || baseResult != FAIL) {
+			diff.NewFailures = append(diff.NewFailures, id)
+		}
+		if inBase && baseResult == FAIL && headResults[id] != FAIL {
+			diff.Fixed = append(diff.Fixed, id)
+		}
+	}
+
+	for _, id := range testIDs(base) {
+		if _, inHead := headResults[id]; !inHead {
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+
+	return diff
+}
+
+// testResults returns the last result of each test in report.
+func testResults(report *Report) map[TestID]Result {
+	results := map[TestID]Result{}
+	for _, p := range report.Packages {
+		for _, t := range p.Tests {
+			results[TestID{p.Name, t.Name}] = t.Result
+		}
+	}
+	return results
+}
+
+// testIDs returns the unique tests of report in the order they first appear.
+func testIDs(report *Report) []TestID {
+	var ids []TestID
+	seen := map[TestID]bool{}
+	for _, p := range report.Packages {
+		for _, t := range p.Tests {
+			id := TestID{p.Name, t.Name}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// FilterChanged returns a new report containing only the tests of head whose
+// result changed compared to base, i.e. the new failures and fixed tests of
+// Diff. Packages without any remaining tests are dropped.
+func FilterChanged(base, head *Report) *Report {
+	diff := Diff(base, head)
+
+	changed := map[TestID]bool{}
+	for _, id := range diff.NewFailures {
+		changed[id] = true
+	}
+	for _, id := range diff.Fixed {
+		changed[id] = true
+	}
+
+	report := &Report{Packages: make([]Package, 0), TotalCoverage: head.TotalCoverage, Summary: head.Summary}
+	for _, p := range head.Packages {
+		tests := make([]*Test, 0)
+		for _, t := range p.Tests {
+			if changed[TestID{p.Name, t.Name}] {
+				tests = append(tests, t)
+			}
+		}
+		if len(tests) == 0 {
+			continue
+		}
+
+		p.Tests = tests
+		report.Packages = append(report.Packages, p)
+	}
+
+	return report
+}
@@ -0,0 +1,244 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// testEvent is a single event of the go test -json output, see
+// https://golang.org/cmd/test2json for a description of the fields.
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// ParseJSON parses the event stream written by go test -json from reader r
+// and returns a report with the results. An optional pkgName can be given,
+// which is used for events that have no package. Lines which are no events,
+// e.g. the build errors go test writes to stderr, are read like the output of
+// go test -v, so packages which failed to build are reported as in Parse.
+// Reruns, e.g. with -count, data races, timeouts and skip reasons are
+// reported like in Parse.
+func ParseJSON(r io.Reader, pkgName string) (*Report, error) {
+	reader := bufio.NewReader(r)
+
+	report := &Report{Packages: make([]Package, 0)}
+
+	// index in report.Packages of each package we've seen
+	packages := map[string]int{}
+	findPackage := func(name string) *Package {
+		idx, ok := packages[name]
+		if !ok {
+			report.Packages = append(report.Packages, Package{
+				Name:  name,
+				Tests: make([]*Test, 0),
+			})
+			idx = len(report.Packages) - 1
+			packages[name] = idx
+		}
+		return &report.Packages[idx]
+	}
+
+	// capture any non-test output per package
+	buffers := map[string][]string{}
+
+	// build output of each package and the package whose build output is
+	// currently read
+	captures := map[string][]string{}
+	capturedPackage := ""
+
+	// tests which have started but not finished yet, and the test whose
+	// skip event was the previous event
+	running := map[*Test]bool{}
+	var skipped *Test
+
+	// buildFailed adds a dummy test with the build output to the package
+	// with the given result line
+	buildFailed := func(matches []string) {
+		pkg := findPackage(matches[2])
+		pkg.BuildFailed = true
+		pkg.Tests = []*Test{
+			{
+				Name:    matches[4],
+				Result:  FAIL,
+				Output:  captures[matches[2]],
+				Package: matches[2],
+			},
+		}
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		} else if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		var event testEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			// not an event, e.g. the build output go test writes to stderr
+			if matches := regexResult.FindStringSubmatch(line); len(matches) == 8 {
+				capturedPackage = ""
+				if strings.HasSuffix(matches[4], "failed]") {
+					buildFailed(matches)
+				}
+			} else if strings.HasPrefix(line, "# ") {
+				capturedPackage = line[2:]
+			} else if capturedPackage != "" {
+				captures[capturedPackage] = append(captures[capturedPackage], line)
+			}
+			continue
+		}
+
+		name := event.Package
+		if name == "" {
+			name = pkgName
+		}
+		pkg := findPackage(name)
+
+		// the reason of a skipped test is printed right after its status in
+		// go versions before 1.14
+		prevSkipped := skipped
+		skipped = nil
+
+		if event.Test == "" {
+			// package level event
+			switch event.Action {
+			case "output":
+				line := strings.TrimRight(event.Output, "\n")
+				if matches := regexCoverage.FindStringSubmatch(line); len(matches) == 2 {
+					pkg.CoveragePct = matches[1]
+				} else if matches := regexResult.FindStringSubmatch(line); len(matches) == 8 {
+					if strings.HasSuffix(matches[4], "failed]") {
+						buildFailed(matches)
+					} else if matches[6] != "" {
+						pkg.CoveragePct = matches[6]
+					}
+					pkg.NoTests = matches[7] != ""
+				} else if regexTimeout.MatchString(line) {
+					// the panic is not attributed to a test, it belongs to
+					// the tests still running
+					for _, test := range pkg.Tests {
+						if running[test] {
+							test.TimedOut = true
+							test.Output = append(test.Output, line)
+						}
+					}
+				} else if !regexSummary.MatchString(line) {
+					buffers[name] = append(buffers[name], line)
+				}
+			case "pass", "fail", "skip":
+				pkg.Time = event.Elapsed
+				if event.Action == "fail" && len(pkg.Tests) == 0 && len(buffers[name]) > 0 {
+					// This package didn't have any tests, but it failed with some
+					// output. Create a dummy test with the output.
+					pkg.Tests = append(pkg.Tests, &Test{
+						Name:      "Failure",
+						Result:    FAIL,
+						Output:    buffers[name],
+						Package:   name,
+						ErrorKind: ErrorSetup,
+					})
+				}
+				delete(buffers, name)
+			}
+			continue
+		}
+
+		switch event.Action {
+		case "run":
+			if test := findTest(pkg.Tests, event.Test); test != nil {
+				// the test is run again, e.g. with -count
+				rerun(test, nil)
+				running[test] = true
+				continue
+			}
+			test := &Test{
+				Name:    event.Test,
+				Result:  FAIL,
+				Output:  make([]string, 0),
+				Parent:  findParent(pkg.Tests, event.Test),
+				Package: name,
+			}
+			pkg.Tests = append(pkg.Tests, test)
+			running[test] = true
+		case "output":
+			test := findTest(pkg.Tests, event.Test)
+			if test == nil {
+				continue
+			}
+
+			line := strings.TrimRight(event.Output, "\n")
+			if strings.HasPrefix(line, "=== ") || regexStatus.MatchString(line) {
+				// test status lines are already reported as separate events
+				continue
+			}
+			if matches := regexOutput.FindStringSubmatch(line); len(matches) == 3 {
+				line = matches[2]
+			} else {
+				// newer go versions indent test output with spaces
+				line = strings.TrimPrefix(line, "    ")
+			}
+			switch {
+			case test == prevSkipped && strings.TrimSpace(line) != "":
+				test.SkipReason = strings.TrimSpace(line)
+			case line == "WARNING: DATA RACE":
+				test.Raced = true
+			case regexTimeout.MatchString(line):
+				test.TimedOut = true
+			}
+			test.Output = append(test.Output, line)
+		case "pass", "fail", "skip":
+			test := findTest(pkg.Tests, event.Test)
+			if test == nil {
+				continue
+			}
+
+			switch event.Action {
+			case "pass":
+				test.Result = PASS
+			case "skip":
+				test.Result = SKIP
+			default:
+				test.Result = FAIL
+			}
+			test.Time = event.Elapsed
+			if test.Runs != nil {
+				test.Runs = append(test.Runs, test.Result)
+			}
+			if test.Result == SKIP {
+				// since go 1.14 the reason is printed before the status
+				if n := len(test.Output); n > 0 {
+					test.SkipReason = strings.TrimSpace(test.Output[n-1])
+				}
+				skipped = test
+			}
+			delete(running, test)
+		}
+	}
+
+	for _, pkg := range report.Packages {
+		finishRuns(pkg.Tests)
+	}
+
+	return report, nil
+}
+
+// findParent returns the name of the innermost test in tests that the test
+// with the given name is a subtest of, or an empty string for top-level tests.
+func findParent(tests []*Test, name string) string {
+	var parent string
+	for _, t := range tests {
+		if strings.HasPrefix(name, t.Name+"/") && len(t.Name) > len(parent) {
+			parent = t.Name
+		}
+	}
+	return parent
+}
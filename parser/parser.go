@@ -2,9 +2,13 @@ package parser
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -20,62 +24,473 @@ const (
 	SKIP
 )
 
+// String returns the name of the result as printed by go test, or UNKNOWN for
+// invalid results.
+func (r Result) String() string {
+	switch r {
+	case PASS:
+		return "PASS"
+	case FAIL:
+		return "FAIL"
+	case SKIP:
+		return "SKIP"
+	default:
+		return "UNKNOWN"
+	}
+}
+
 // Report is a collection of package tests.
 type Report struct {
-	Packages []Package
+	Packages []Package `json:"packages"`
+
+	// TotalCoverage is the coverage percentage of all packages, from a
+	// "total: (statements)" line in the output.
+	TotalCoverage string `json:"totalCoverage,omitempty"`
+
+	// Summary is the summary printed by gotestsum after all packages, if
+	// the output was written by it.
+	Summary *Summary `json:"summary,omitempty"`
 }
 
-// Package contains the test results of a single package.
+// Summary contains the totals gotestsum prints after all packages, e.g.
+// "DONE 42 tests, 2 failures in 3.456s". They can be used to check the
+// totals of a report.
+type Summary struct {
+	Tests    int     `json:"tests"`
+	Skipped  int     `json:"skipped"`
+	Failures int     `json:"failures"`
+	Errors   int     `json:"errors"`
+	Time     float64 `json:"time"`
+}
+
+// Package contains the test results of a single package. Setup contains the
+// output of the package before its first test started.
 type Package struct {
-	Name        string
-	Time        float64
-	Tests       []*Test
-	CoveragePct string
+	Name        string       `json:"name"`
+	Time        float64      `json:"time"`
+	Tests       []*Test      `json:"tests"`
+	Benchmarks  []*Benchmark `json:"benchmarks,omitempty"`
+	CoveragePct string       `json:"coveragePct"`
+	Hostname    string       `json:"hostname,omitempty"`
+	BuildFailed bool         `json:"buildFailed"`
+	Cached      bool         `json:"cached"`
+	Setup       []string     `json:"setup,omitempty"`
+
+	// NoTests is set if go test warned, or noted on the result line, that
+	// the package had no tests to run, e.g. because -run matched none of them.
+	NoTests bool `json:"noTests"`
+}
+
+// Duration returns the time of the package, rounded to the nearest
+// nanosecond.
+func (p *Package) Duration() time.Duration {
+	return seconds(p.Time)
+}
+
+// Coverage returns the statement coverage percentage of the package, and
+// false if the package did not report its coverage.
+func (p *Package) Coverage() (float64, bool) {
+	return parseCoverage(p.CoveragePct)
+}
+
+// Coverage returns the total statement coverage percentage of all packages,
+// and false if it was not reported.
+func (r *Report) Coverage() (float64, bool) {
+	return parseCoverage(r.TotalCoverage)
+}
+
+func parseCoverage(pct string) (float64, bool) {
+	if pct == "" {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(pct, 64)
+	return f, err == nil
 }
 
-// Test contains the results of a single test.
+// Test contains the results of a single test. If the test was run more than
+// once, Runs and RunOutput contain the result and output of each run, while
+// Result and Output are those of the last run.
 type Test struct {
-	Name         string
-	Time         float64
-	CreationTime float64
-	DestroyTime  float64
-	Result       Result
-	Output       []string
+	Name         string     `json:"name"`
+	Time         float64    `json:"time"`
+	CreationTime float64    `json:"creationTime"`
+	DestroyTime  float64    `json:"destroyTime"`
+	Result       Result     `json:"result"`
+	Output       []string   `json:"output"`
+	Package      string     `json:"package"`
+	Parent       string     `json:"parent,omitempty"`
+	Runs         []Result   `json:"runs,omitempty"`
+	RunOutput    [][]string `json:"runOutput,omitempty"`
+
+	// Raced is set if the race detector reported a data race while the test
+	// was running, its output then contains the report of the race.
+	Raced bool `json:"raced,omitempty"`
+
+	// TimedOut is set if go test panicked because the test exceeded the
+	// -timeout, its output then ends with the goroutine dump of the panic.
+	TimedOut bool `json:"timedOut,omitempty"`
+
+	// TimesEstimated is set if only the start of the creation or destroy
+	// step was found, so CreationTime and DestroyTime are estimates.
+	TimesEstimated bool `json:"timesEstimated,omitempty"`
+
+	// ErrorKind is set for failed tests which represent an error rather than
+	// a failed assertion, e.g. ErrorSetup.
+	ErrorKind string `json:"errorKind,omitempty"`
+
+	// SkipReason is the reason passed to t.Skip, the first indented line of
+	// output after the status of a skipped test or, if there is none, the
+	// last line of output before it.
+	SkipReason string `json:"skipReason,omitempty"`
+
+	// Slow is set for tests which took longer than the threshold given to
+	// Report.MarkSlow.
+	Slow bool `json:"slow,omitempty"`
+
+	// start time of the creation step of the current run and the destroy
+	// steps run since, a destroy step ends when another creation step starts
+	creationStart time.Time
+	destroySteps  []phase
+
+	// whether the test was added for a testify suite whose own test was
+	// not reported, it takes the time and result of the suite methods
+	synthetic bool
+
+	// whether this is a dummy test for the failure of its package, which is
+	// named by Options.NoTestFailureName once the package is known
+	dummy bool
+}
+
+// ErrorSetup is the ErrorKind of the dummy tests added to packages which
+// failed before running any test, e.g. in TestMain or in an init function.
+const ErrorSetup = "setup"
+
+// phase is a step of a test that ran from start to end, end is zero while the
+// step is still running. Destroying a replaced resource during the creation
+// step is a replace phase, it ends when the resource is created again.
+type phase struct {
+	start, end time.Time
+	replace    bool
+}
+
+// IsSubtest returns true if the test is a subtest, i.e. its name contains a
+// slash.
+func (t *Test) IsSubtest() bool {
+	return strings.Contains(t.Name, "/")
+}
+
+// TopLevelName returns the name of the top-level test the test belongs to,
+// which is the part of its name before the first slash.
+func (t *Test) TopLevelName() string {
+	if idx := strings.Index(t.Name, "/"); idx > -1 {
+		return t.Name[:idx]
+	}
+	return t.Name
+}
+
+// MarshalJSON encodes the test together with its isSubtest and topLevelName
+// fields, which are derived from its name.
+func (t *Test) MarshalJSON() ([]byte, error) {
+	type test Test
+	return json.Marshal(struct {
+		*test
+		IsSubtest    bool   `json:"isSubtest"`
+		TopLevelName string `json:"topLevelName"`
+	}{(*test)(t), t.IsSubtest(), t.TopLevelName()})
+}
+
+// Duration returns the time of the test, rounded to the nearest nanosecond.
+func (t *Test) Duration() time.Duration {
+	return seconds(t.Time)
+}
+
+// seconds converts a time in seconds, which is never negative, to a
+// duration, rounded to the nearest nanosecond. math.Round needs Go 1.10.
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Floor(s*float64(time.Second) + 0.5))
+}
+
+// Flaky returns true if the test was run more than once and both passed and
+// failed.
+func (t *Test) Flaky() bool {
+	passed, failed := false, false
+	for _, r := range t.Runs {
+		passed = passed || r == PASS
+		failed = failed || r == FAIL
+	}
+	return passed && failed
+}
+
+// Benchmark contains the results of a single benchmark.
+type Benchmark struct {
+	Name        string  `json:"name"`
+	Iterations  int64   `json:"iterations"`
+	NsPerOp     float64 `json:"nsPerOp"`
+	BytesPerOp  int64   `json:"bytesPerOp"`
+	AllocsPerOp int64   `json:"allocsPerOp"`
 }
 
 var (
-	regexStatus        = regexp.MustCompile(`^\s*--- (PASS|FAIL|SKIP): (.+) \((\d+\.\d+)(?: seconds|s)\)$`)
+	regexStatus        = regexp.MustCompile(`^\s*--- (PASS|FAIL|SKIP): (.+) \(((?:\d+h)?(?:\d+m)?\d+(?:\.\d+)?)(?: seconds|s)\)$`)
 	regexCoverage      = regexp.MustCompile(`^coverage:\s+(\d+\.\d+)%\s+of\s+statements(?:\sin\s.+)?$`)
-	regexResult        = regexp.MustCompile(`^(ok|FAIL)\s+([^ ]+)\s+(?:(\d+\.\d+)s|(\[\w+ failed]))(?:\s+coverage:\s+(\d+\.\d+)%\sof\sstatements(?:\sin\s.+)?)?$`)
-	regexOutput        = regexp.MustCompile(`(    )*\t(.*)`)
+	regexTotalCoverage = regexp.MustCompile(`^total:\s+\(statements\)\s+(\d+\.\d+)%$`)
+	regexResult        = regexp.MustCompile(`^(ok|FAIL)\s+([^ ]+)\s+(?:((?:\d+h)?(?:\d+m)?\d+(?:\.\d+)?)s|(\[\w+ failed])|(\(cached\)))(?:\s+coverage:\s+(\d+\.\d+)%\sof\sstatements(?:\sin\s.+)?)?(\s+\[no tests to run\])?$`)
+	regexOutput        = regexp.MustCompile(`^(    )*\t(.*)`)
 	regexSummary       = regexp.MustCompile(`^(PASS|FAIL|SKIP)$`)
 	regexTimeFormat    = regexp.MustCompile(`(\d{4})/(\d{2})/(\d{2})\s(\d{2}):(\d{2}):(\d{2})`)
-	regexCreationStart = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2}\s\d{2}:\d{2}:\d{2})\s\[INFO\]\sTest:\sUsing\s([\w-]+)\sas\stest\sregion$`)
-	regexDestroyStart  = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2}\s\d{2}:\d{2}:\d{2})\s\[WARN\]\s(Test:\sExecuting\sdestroy\sstep)$`)
+	regexCreationStart = terraformPattern(creationStartFormat, `\[INFO\]`)
+	regexDestroyStart  = terraformPattern(destroyStartFormat, `\[WARN\]`)
+	regexDeleteChange  = terraformPattern(deleteChangeFormat, `\[DEBUG\]`)
+	regexCreateChange  = terraformPattern(createChangeFormat, `\[DEBUG\]`)
+	regexPrefixedRun   = regexp.MustCompile(`^(\S+) === RUN `)
+	regexPanic         = regexp.MustCompile(`^panic: `)
+	regexTimeout       = regexp.MustCompile(`^panic: test timed out after \S+$`)
+	regexRaceSeparator = regexp.MustCompile(`^=+$`)
+	regexDone          = regexp.MustCompile(`^DONE (?:\d+ runs?, )?(\d+) tests?(?:, (\d+) skipped)?(?:, (\d+) failures?)?(?:, (\d+) errors?)? in ((?:\d+h)?(?:\d+m)?\d+(?:\.\d+)?)s$`)
+	regexKnownOutput   = regexp.MustCompile(`^(?:exit status \d+|goos: .+|goarch: .+|pkg: .+|cpu: .+|=+|=== (?:Skipped|Failed|Errors)|=== (?:SKIP|FAIL): .+)$`)
+	regexANSI          = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+	regexBenchmark     = regexp.MustCompile(`^(Benchmark\S+?)(?:-\d+)?\s+(\d+)\s+(\d+(?:\.\d+)?) ns/op(?:\s+\d+(?:\.\d+)? MB/s)?(?:\s+(\d+) B/op)?(?:\s+(\d+) allocs/op)?`)
+)
+
+// formats of the log lines marking the start of the creation and destroy
+// steps of a Terraform acceptance test, and of the delete and create changes
+// applied when a resource is replaced, %s is replaced by the log level
+const (
+	creationStartFormat = `^(\d{4}/\d{2}/\d{2}\s\d{2}:\d{2}:\d{2})\s(?:%s)\s+Test:\sUsing\s([\w-]+)\sas\stest\sregion$`
+	destroyStartFormat  = `^(\d{4}/\d{2}/\d{2}\s\d{2}:\d{2}:\d{2})\s(?:%s)\s+(Test:\sExecuting\sdestroy\sstep)$`
+	deleteChangeFormat  = `^(\d{4}/\d{2}/\d{2}\s\d{2}:\d{2}:\d{2})\s(?:%s)\s+(\S+):\sapplying\sthe\splanned\sDelete\schange$`
+	createChangeFormat  = `^(\d{4}/\d{2}/\d{2}\s\d{2}:\d{2}:\d{2})\s(?:%s)\s+(\S+):\sapplying\sthe\splanned\sCreate\schange$`
 )
 
+// terraformPattern returns the Terraform log line pattern of the given
+// format, matching log levels with the logLevel pattern.
+func terraformPattern(format, logLevel string) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(format, logLevel))
+}
+
+// console writes debug output of the parser to its Target. Output is
+// discarded while Target is nil.
+type console struct {
+	Target io.Writer
+}
+
+// Printf writes the formatted debug output to the console target.
+func (c *console) Printf(format string, a ...interface{}) {
+	if c.Target == nil {
+		return
+	}
+	fmt.Fprintf(c.Target, format, a...)
+}
+
+// Console receives the debug output of Parse. It is disabled by default, set
+// its Target to enable it.
+var Console = &console{}
+
+// Options contains optional settings which change how Parse interprets the
+// go test output.
+type Options struct {
+	// PackagePrefix is stripped, together with the space following it, from
+	// the start of every line before it is parsed. This supports wrappers
+	// which prefix each line of verbose output with the package name. When
+	// empty, the prefix is detected automatically from prefixed "=== RUN"
+	// lines.
+	PackagePrefix string
+
+	// HostnamePattern matches log lines which mark the node a package is
+	// running on. The first submatch is used as the hostname of the package.
+	// Matching lines are not included in the test output.
+	HostnamePattern *regexp.Regexp
+
+	// StripOutput is removed from every line of test output it matches, for
+	// example to remove the noise added by go test -exec wrappers. Lines
+	// which are empty once the match is removed are dropped. Unlike
+	// PackagePrefix it does not affect how lines are parsed.
+	StripOutput *regexp.Regexp
+
+	// CreationStartPattern and DestroyStartPattern match the log lines which
+	// mark the start of the creation and destroy steps of a Terraform
+	// acceptance test, used to compute its CreationTime and DestroyTime. Their
+	// first submatch must be the time of the line, formatted like
+	// 2006/01/02 15:04:05. When nil, the log lines of the Terraform test
+	// framework are matched.
+	CreationStartPattern *regexp.Regexp
+	DestroyStartPattern  *regexp.Regexp
+
+	// LogLevelPattern matches the log level of the Terraform log lines
+	// matched when CreationStartPattern or DestroyStartPattern is nil, e.g.
+	// \[DEBUG\] when running with TF_LOG=DEBUG or level=\w+ for structured
+	// logs. When nil, the creation step is logged as [INFO] and the destroy
+	// step as [WARN].
+	LogLevelPattern *regexp.Regexp
+
+	// KeepColor keeps ANSI escape sequences, e.g. colors, in the output of
+	// tests. They are always removed before lines are parsed.
+	KeepColor bool
+
+	// BuildFailureName and NoTestFailureName are the names of the dummy
+	// tests added to packages whose build failed and for failures outside of
+	// tests, e.g. of packages which failed without running any tests or
+	// panics and data races while no test was running. Any {package} in them
+	// is replaced by the name of the package. When empty, the result of the
+	// build, e.g. "[build failed]", and "Failure" are used.
+	BuildFailureName  string
+	NoTestFailureName string
+
+	// Strict makes parsing fail with an UnrecognizedError if more than
+	// MaxUnrecognized lines were not recognized, e.g. because a new version
+	// of Go changed the format of its output. Output of tests which is not
+	// indented is not recognized either, empty lines are ignored.
+	Strict          bool
+	MaxUnrecognized int
+
+	// Stats is set to the number of lines of each kind found in the input,
+	// if not nil, e.g. to check how well a new output format is understood.
+	Stats *Stats
+
+	// MergePackages combines packages with the same name, e.g. when the
+	// output of several test runs was concatenated, see Report.Merge.
+	MergePackages bool
+
+	// Progress is called by ParseWithOptions with each package as soon as it
+	// is finished, before the report is complete, e.g. to write partial
+	// reports. The package must not be modified.
+	Progress func(Package)
+}
+
 // Parse parses go test output from reader r and returns a report with the
 // results. An optional pkgName can be given, which is used in case a package
 // result line is missing.
 func Parse(r io.Reader, pkgName string) (*Report, error) {
+	return ParseWithOptions(r, pkgName, Options{})
+}
+
+// ParseWithOptions is like Parse, but allows changing the parser behaviour
+// using opts.
+func ParseWithOptions(r io.Reader, pkgName string, opts Options) (*Report, error) {
+	report := &Report{Packages: make([]Package, 0)}
+
+	totals, err := parse(readLines(r), pkgName, opts, func(p Package) error {
+		report.Packages = append(report.Packages, p)
+		if opts.Progress != nil {
+			opts.Progress(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.TotalCoverage = totals.TotalCoverage
+	report.Summary = totals.Summary
+
+	if opts.MergePackages {
+		merged := &Report{Packages: make([]Package, 0)}
+		merged.Merge(report)
+		return merged, nil
+	}
+
+	return report, nil
+}
+
+// ParseStream parses go test output from reader r like Parse, but calls emit
+// with each package as soon as it is finished instead of collecting them in
+// a report. The parser keeps no reference to emitted packages, so only the
+// package being parsed is held in memory. Parsing stops with the error
+// returned by emit, if any.
+func ParseStream(r io.Reader, pkgName string, emit func(Package) error) error {
+	return ParseStreamWithOptions(r, pkgName, Options{}, emit)
+}
+
+// ParseStreamWithOptions is like ParseStream, but allows changing the parser
+// behaviour using opts. Packages are emitted separately, so
+// opts.MergePackages has no effect and the total coverage and summary of a
+// report are not available.
+func ParseStreamWithOptions(r io.Reader, pkgName string, opts Options, emit func(Package) error) error {
+	_, err := parse(readLines(r), pkgName, opts, emit)
+	return err
+}
+
+// readLines returns a function returning the next line of r on every call,
+// without its line ending.
+func readLines(r io.Reader) func() (string, error) {
 	reader := bufio.NewReader(r)
 
-	report := &Report{make([]Package, 0)}
+	return func() (string, error) {
+		l, _, err := reader.ReadLine()
+		return string(l), err
+	}
+}
+
+// ParseLines parses go test output that was already split into lines, which
+// must not contain line endings, and returns a report with the results like
+// Parse.
+func ParseLines(lines []string, pkgName string) (*Report, error) {
+	report := &Report{Packages: make([]Package, 0)}
+
+	totals, err := parse(func() (string, error) {
+		if len(lines) == 0 {
+			return "", io.EOF
+		}
+		line := lines[0]
+		lines = lines[1:]
+		return line, nil
+	}, pkgName, Options{}, func(p Package) error {
+		report.Packages = append(report.Packages, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.TotalCoverage = totals.TotalCoverage
+	report.Summary = totals.Summary
+
+	return report, nil
+}
+
+// parse parses the go test output lines returned by nextLine until it
+// returns io.EOF, and calls emit with each finished package. It returns a
+// report without packages, containing the total coverage and summary of all
+// packages if found.
+func parse(nextLine func() (string, error), pkgName string, opts Options, emit func(Package) error) (Report, error) {
+	// the last finished package, it is emitted once the line after its
+	// result line has been parsed, which may contain its coverage
+	var finished *Package
+
+	// emitPackage sets the package of all tests of p and the names of its
+	// dummy tests before emitting it
+	emitPackage := func(p Package) error {
+		for _, test := range p.Tests {
+			test.Package = p.Name
+			if test.dummy {
+				test.Name = failureName(opts.NoTestFailureName, p.Name, "Failure")
+				test.dummy = false
+			}
+		}
+		return emit(p)
+	}
+
+	flush := func() error {
+		if finished == nil {
+			return nil
+		}
+		p := *finished
+		finished = nil
+		finishRuns(p.Tests)
+		return emitPackage(p)
+	}
 
 	// keep track of tests we find
 	var tests []*Test
 
-	// sum of tests' time, use this if current test has no result line (when it is compiled test)
-	testsTime := 0.0
-
-	// current test
-	var cur string
+	// keep track of benchmarks we find
+	var benchmarks []*Benchmark
 
-	// Creation start time of each test case.©
-	var creationStartTime time.Time
+	// sum of the time of top-level tests, which includes the time of their
+	// subtests, use this if current test has no result line (when it is
+	// compiled test)
+	testsTime := 0.0
 
-	// Destroy start time of each test case.
-	var destroyStartTime time.Time
+	// current test, output and Terraform step times are added to it
+	var cur *Test
 
 	// keep track if we've already seen a summary for the current test
 	var seenSummary bool
@@ -83,6 +498,18 @@ func Parse(r io.Reader, pkgName string) (*Report, error) {
 	// coverage percentage report for current package
 	var coveragePct string
 
+	// hostname of the node running the current package
+	var hostname string
+
+	// whether the current package had no tests to run
+	var noTests bool
+
+	// test whose status line was the previous line if it was skipped
+	var skipped *Test
+
+	// failed example whose got and want output follows its status line
+	var failedExample *Test
+
 	// stores mapping between package name and output of build failures
 	var packageCaptures = map[string][]string{}
 
@@ -92,106 +519,554 @@ func Parse(r io.Reader, pkgName string) (*Report, error) {
 	// capture any non-test output
 	var buffer []string
 
+	// output of the current package before its first test
+	var setup []string
+
+	// test the output of a panic is being captured for
+	var panicTest *Test
+
+	// test the report of a data race is being captured for
+	var raceTest *Test
+
+	// names of the tests at each subtest depth of the last status lines
+	var parents []string
+
+	// keep track if the previous line was a package result line
+	var afterResult bool
+
+	// tests of packages whose output was interrupted by the output of another
+	// package running in parallel
+	var pending []*packageTests
+
+	// package prefix to strip from each line, either given or detected
+	prefix := opts.PackagePrefix
+
+	// total coverage and summary of all packages
+	var totals Report
+
+	// log lines marking the start of the creation and destroy steps
+	creationStart, destroyStart := regexCreationStart, regexDestroyStart
+	deleteChange, createChange := regexDeleteChange, regexCreateChange
+	if opts.LogLevelPattern != nil {
+		creationStart = terraformPattern(creationStartFormat, opts.LogLevelPattern.String())
+		destroyStart = terraformPattern(destroyStartFormat, opts.LogLevelPattern.String())
+		deleteChange = terraformPattern(deleteChangeFormat, opts.LogLevelPattern.String())
+		createChange = terraformPattern(createChangeFormat, opts.LogLevelPattern.String())
+	}
+	if opts.CreationStartPattern != nil {
+		creationStart = opts.CreationStartPattern
+	}
+	if opts.DestroyStartPattern != nil {
+		destroyStart = opts.DestroyStartPattern
+	}
+
+	// number of the current line and the lines that were not recognized
+	lineNumber := 0
+	unrecognized := &UnrecognizedError{}
+
+	// number of lines of each kind, for opts.Stats
+	var stats Stats
+
 	// parse lines
 	for {
-		l, _, err := reader.ReadLine()
+		line, err := nextLine()
 		if err != nil && err == io.EOF {
 			break
 		} else if err != nil {
-			return nil, err
+			return Report{}, err
+		}
+		lineNumber++
+
+		// output captured on Windows ends lines with \r\n
+		line = strings.TrimSuffix(line, "\r")
+
+		// colored output is parsed without its escape sequences, colored is
+		// only used as test output with opts.KeepColor
+		colored := line
+		line = stripANSI(line)
+
+		seenResult := afterResult
+		afterResult = false
+
+		if !seenResult {
+			if err := flush(); err != nil {
+				return Report{}, err
+			}
+		}
+
+		if opts.PackagePrefix == "" {
+			// detect the prefix of the package that is currently running, the
+			// output of packages running in parallel may be interleaved
+			next := prefix
+			if matches := regexPrefixedRun.FindStringSubmatch(line); len(matches) == 2 {
+				next = matches[1]
+			} else if idx := strings.Index(line, " "); idx > 0 && findPending(pending, line[:idx]) != nil {
+				next = line[:idx]
+			}
+
+			if prefix != "" && next != prefix {
+				// keep the tests of the interrupted package until its result
+				// line and continue with the tests of the next package
+				if len(tests) > 0 || len(benchmarks) > 0 {
+					pending = append(pending, &packageTests{
+						name:        prefix,
+						tests:       tests,
+						benchmarks:  benchmarks,
+						setup:       setup,
+						coveragePct: coveragePct,
+						hostname:    hostname,
+						noTests:     noTests,
+						cur:         cur,
+						parents:     parents,
+						testsTime:   testsTime,
+					})
+				}
+				tests, benchmarks, setup, coveragePct, hostname, noTests = make([]*Test, 0), nil, nil, "", "", false
+				cur, parents, testsTime = nil, nil, 0
+
+				var p *packageTests
+				if p, pending = takePending(pending, next); p != nil {
+					tests, benchmarks, setup, coveragePct, hostname, noTests = p.tests, p.benchmarks, p.setup, p.coveragePct, p.hostname, p.noTests
+					cur, parents, testsTime = p.cur, p.parents, p.testsTime
+				}
+			}
+			prefix = next
+		}
+		if prefix != "" && strings.HasPrefix(line, prefix+" ") {
+			line = line[len(prefix)+1:]
+			colored = strings.TrimPrefix(colored, prefix+" ")
+		}
+		if !opts.KeepColor {
+			colored = line
+		}
+
+		if skipped != nil {
+			// the reason of a skipped test is printed right after its status
+			test := skipped
+			skipped = nil
+
+			indented := strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "    ")
+			if indented && !regexStatus.MatchString(line) {
+				test.SkipReason = strings.TrimSpace(line)
+
+				// tab indented output is added to the test below, but output
+				// indented with spaces would be buffered for the next test
+				if !regexOutput.MatchString(line) {
+					if output, ok := stripOutput(opts.StripOutput, test.SkipReason); ok {
+						test.Output = append(test.Output, output)
+					}
+					continue
+				}
+			}
+		}
+
+		if opts.HostnamePattern != nil {
+			if matches := opts.HostnamePattern.FindStringSubmatch(line); len(matches) > 1 {
+				hostname = matches[1]
+				continue
+			}
+		}
+
+		if panicTest != nil {
+			if strings.HasPrefix(line, "=== RUN ") || regexResult.MatchString(line) {
+				// the stack trace ends with the next test or package result
+				panicTest = nil
+			} else {
+				panicTest.Output = append(panicTest.Output, line)
+				continue
+			}
+		}
+
+		if raceTest != nil {
+			// the race report ends with a line of equal signs
+			raceTest.Output = append(raceTest.Output, line)
+			if regexRaceSeparator.MatchString(line) {
+				raceTest = nil
+			}
+			continue
 		}
 
-		line := string(l)
+		if line == "testing: warning: no tests to run" {
+			// not output of the package, a package without tests passes
+			noTests = true
+			continue
+		}
+
+		if line == "WARNING: DATA RACE" {
+			// capture the race report for the running test, or for a dummy
+			// test if no test is running
+			raceTest = cur
+			if raceTest == nil {
+				raceTest = &Test{
+					Name:   "Failure",
+					Output: make([]string, 0),
+					dummy:  true,
+				}
+				tests = append(tests, raceTest)
+			}
+			raceTest.Result = FAIL
+			raceTest.Raced = true
 
-		if strings.HasPrefix(line, "=== RUN ") {
+			// the report starts with a line of equal signs, keep it and the
+			// output buffered before it in order
+			var separator []string
+			if n := len(buffer); n > 0 && regexRaceSeparator.MatchString(buffer[n-1]) {
+				separator, buffer = buffer[n-1:], buffer[:n-1]
+			}
+			raceTest.Output = append(raceTest.Output, buffer...)
+			raceTest.Output = append(raceTest.Output, separator...)
+			raceTest.Output = append(raceTest.Output, line)
+			buffer = buffer[0:0]
+		} else if regexPanic.MatchString(line) {
+			// capture the panic and its stack trace for the running test, or
+			// for a dummy test if no test is running. The status line of a
+			// panicking test is printed before the panic, a test which passed
+			// or was skipped has finished before it.
+			panicTest = cur
+			if panicTest != nil && panicTest.Result != FAIL {
+				panicTest = nil
+			}
+			if panicTest == nil {
+				panicTest = &Test{
+					Name:   "Failure",
+					Output: make([]string, 0),
+					dummy:  true,
+				}
+				if cur == nil {
+					panicTest.ErrorKind = ErrorSetup
+				}
+				tests = append(tests, panicTest)
+			}
+			panicTest.Result = FAIL
+			panicTest.TimedOut = regexTimeout.MatchString(line)
+			panicTest.Output = append(panicTest.Output, line)
+		} else if strings.HasPrefix(line, "=== RUN ") {
 			// new test
-			cur = strings.TrimSpace(line[8:])
-			tests = append(tests, &Test{
-				Name:   cur,
-				Result: FAIL,
-				Output: make([]string, 0),
-			})
+			name := strings.TrimSpace(line[8:])
+			if cur != nil && strings.HasPrefix(name, cur.Name+"/") {
+				// the running test starts a subtest, the output buffered so
+				// far was written by it rather than by the subtest
+				cur.Output = append(cur.Output, buffer...)
+				buffer = buffer[0:0]
+			}
+			suite, isMethod := suiteName(name)
+			if isMethod && cur != nil && cur.Parent == suite {
+				// the status lines of testify suite methods are only printed
+				// after the whole suite, the output buffered so far was
+				// written by the previous method
+				cur.Output = append(cur.Output, buffer...)
+				buffer = buffer[0:0]
+			}
+			if test := findTest(tests, name); test != nil {
+				// the test is run again, e.g. with -count or by a retry
+				// wrapper, output buffered since the previous run finished
+				// still belongs to it
+				rerun(test, buffer)
+				buffer = buffer[0:0]
+				cur = test
+			} else {
+				if len(tests) == 0 {
+					// output before the first test of the package belongs to
+					// the package rather than to that test
+					setup = append(setup, buffer...)
+					buffer = buffer[0:0]
+				}
+				if isMethod && findTest(tests, suite) == nil {
+					// the test running the suite was not reported, add one
+					// to group the suite methods
+					tests = append(tests, &Test{
+						Name:      suite,
+						Result:    PASS,
+						Output:    make([]string, 0),
+						synthetic: true,
+					})
+				}
+				cur = &Test{
+					Name:   name,
+					Result: FAIL,
+					Output: make([]string, 0),
+				}
+				if isMethod {
+					cur.Parent = suite
+				}
+				tests = append(tests, cur)
+			}
 
 			// clear the current build package, so output lines won't be added to that build
 			capturedPackage = ""
+			failedExample = nil
 			seenSummary = false
-		} else if matches := regexCreationStart.FindStringSubmatch(line); len(matches) == 3 {
-			creationStartTime, _ = time.Parse(time.RFC3339, convertToRFC3339(matches[1]))
-		} else if matches := regexDestroyStart.FindStringSubmatch(line); len(matches) == 3 {
-			destroyStartTime, _ = time.Parse(time.RFC3339, convertToRFC3339(matches[1]))
-		} else if matches := regexResult.FindStringSubmatch(line); len(matches) == 6 {
-			if matches[5] != "" {
-				coveragePct = matches[5]
+		} else if strings.HasPrefix(line, "=== PAUSE ") {
+			// a parallel test is paused until its sequential tests are done,
+			// its output continues after an "=== CONT" line
+		} else if strings.HasPrefix(line, "=== CONT ") || strings.HasPrefix(line, "=== NAME ") {
+			// output of another parallel test follows, the output buffered
+			// so far belongs to the previous one
+			if cur != nil {
+				cur.Output = append(cur.Output, buffer...)
+				buffer = buffer[0:0]
+			}
+			cur = findTest(tests, strings.TrimSpace(line[9:]))
+		} else if matches := creationStart.FindStringSubmatch(line); len(matches) > 1 {
+			if cur != nil {
+				start, _ := time.Parse(time.RFC3339, convertToRFC3339(matches[1]))
+				if cur.creationStart.IsZero() {
+					cur.creationStart = start
+				}
+				if n := len(cur.destroySteps); n > 0 && cur.destroySteps[n-1].end.IsZero() {
+					cur.destroySteps[n-1].end = start
+				}
+			}
+		} else if matches := destroyStart.FindStringSubmatch(line); len(matches) > 1 {
+			if cur != nil {
+				start, _ := time.Parse(time.RFC3339, convertToRFC3339(matches[1]))
+				if n := len(cur.destroySteps); n == 0 || !cur.destroySteps[n-1].end.IsZero() {
+					cur.destroySteps = append(cur.destroySteps, phase{start: start})
+				}
 			}
+		} else if matches := deleteChange.FindStringSubmatch(line); len(matches) > 1 {
+			// a resource replaced in the creation step is destroyed before
+			// it is created again, which adds to the destroy time
+			if cur != nil && !cur.creationStart.IsZero() {
+				start, _ := time.Parse(time.RFC3339, convertToRFC3339(matches[1]))
+				if n := len(cur.destroySteps); n == 0 || !cur.destroySteps[n-1].end.IsZero() {
+					cur.destroySteps = append(cur.destroySteps, phase{start: start, replace: true})
+				}
+			}
+		} else if matches := createChange.FindStringSubmatch(line); len(matches) > 1 {
+			if cur != nil {
+				end, _ := time.Parse(time.RFC3339, convertToRFC3339(matches[1]))
+				if n := len(cur.destroySteps); n > 0 && cur.destroySteps[n-1].replace && cur.destroySteps[n-1].end.IsZero() {
+					cur.destroySteps[n-1].end = end
+				}
+			}
+		} else if matches := regexResult.FindStringSubmatch(line); len(matches) == 8 {
+			stats.Results++
+
+			// the package is finished, so build output is no longer being captured
+			capturedPackage = ""
+
 			if strings.HasSuffix(matches[4], "failed]") {
-				// the build of the package failed, inject a dummy test into the package
+				// the build of the package failed, add the package with a dummy test
 				// which indicate about the failure and contain the failure description.
-				tests = append(tests, &Test{
-					Name:   matches[4],
-					Result: FAIL,
-					Output: packageCaptures[matches[2]],
-				})
-			} else if matches[1] == "FAIL" && len(tests) == 0 && len(buffer) > 0 {
+				// Tests and coverage seen so far belong to another package, keep them
+				// for its result line.
+				if err := flush(); err != nil {
+					return Report{}, err
+				}
+				finished = &Package{
+					Name:        matches[2],
+					BuildFailed: true,
+					Tests: []*Test{
+						{
+							Name:   failureName(opts.BuildFailureName, matches[2], matches[4]),
+							Result: FAIL,
+							Output: packageCaptures[matches[2]],
+						},
+					},
+				}
+				continue
+			}
+
+			var p *packageTests
+			if p, pending = takePending(pending, matches[2]); p != nil {
+				// the result of a package whose tests were interrupted by the
+				// output of another package, which is still running
+				if err := flush(); err != nil {
+					return Report{}, err
+				}
+				coverage := p.coveragePct
+				if matches[6] != "" {
+					coverage = matches[6]
+				}
+				finished = &Package{
+					Name:        matches[2],
+					Time:        parseTime(matches[3]),
+					Tests:       p.tests,
+					Benchmarks:  p.benchmarks,
+					CoveragePct: coverage,
+					Hostname:    p.hostname,
+					Cached:      matches[5] != "",
+					Setup:       p.setup,
+					NoTests:     p.noTests || matches[7] != "",
+				}
+				afterResult = true
+				continue
+			}
+
+			if matches[6] != "" {
+				coveragePct = matches[6]
+			}
+			if matches[1] == "FAIL" && len(tests) == 0 && len(buffer) > 0 {
 				// This package didn't have any tests, but it failed with some
 				// output. Create a dummy test with the output.
 				tests = append(tests, &Test{
-					Name:   "Failure",
-					Result: FAIL,
-					Output: append(make([]string, len(buffer), cap(buffer)), buffer...),
+					Name:      failureName(opts.NoTestFailureName, matches[2], "Failure"),
+					Result:    FAIL,
+					Output:    append(make([]string, 0, len(buffer)), buffer...),
+					ErrorKind: ErrorSetup,
 				})
 			}
 
 			// all tests in this package are finished
-			report.Packages = append(report.Packages, Package{
+			if err := flush(); err != nil {
+				return Report{}, err
+			}
+			finished = &Package{
 				Name:        matches[2],
 				Time:        parseTime(matches[3]),
 				Tests:       tests,
+				Benchmarks:  benchmarks,
 				CoveragePct: coveragePct,
-			})
+				Hostname:    hostname,
+				Cached:      matches[5] != "",
+				Setup:       setup,
+				NoTests:     noTests || matches[7] != "",
+			}
 
 			buffer = buffer[0:0]
+			setup = nil
+			noTests = false
 			tests = make([]*Test, 0)
+			benchmarks = nil
 			coveragePct = ""
-			cur = ""
+			hostname = ""
+			parents = nil
+			cur = nil
+			failedExample = nil
 			testsTime = 0
+			afterResult = true
 		} else if matches := regexStatus.FindStringSubmatch(line); len(matches) == 4 {
-			cur = matches[2]
-			test := findTest(tests, cur)
+			stats.Statuses++
+
+			// test results are never part of build output, stop capturing it
+			capturedPackage = ""
+
+			test := findTest(tests, matches[2])
 			if test == nil {
-				continue
+				// packages tested without -v only print the status of failed
+				// tests, without a preceding "=== RUN" line
+				test = &Test{
+					Name:   matches[2],
+					Output: make([]string, 0),
+				}
+				tests = append(tests, test)
 			}
+			cur = test
 
 			// test status
 			if matches[1] == "PASS" {
 				test.Result = PASS
 			} else if matches[1] == "SKIP" {
 				test.Result = SKIP
+				skipped = test
 			} else {
 				test.Result = FAIL
 			}
+			failedExample = nil
+			if test.Result == FAIL && strings.HasPrefix(test.Name, "Example") {
+				failedExample = test
+			}
+			if test.Runs != nil {
+				test.Runs = append(test.Runs, test.Result)
+			}
+			test.synthetic = false
 			test.Output = append(test.Output, buffer...)
 			buffer = buffer[0:0]
+			if test.Result == SKIP && len(test.Output) > 0 {
+				// since Go 1.14 the reason is printed before the status, a
+				// reason printed after it replaces this one below
+				test.SkipReason = strings.TrimSpace(test.Output[len(test.Output)-1])
+			}
 
 			test.Name = matches[2]
+
+			// subtest status lines are indented below the status line of their
+			// parent, use it to find the parent rather than splitting the name,
+			// which may contain slashes itself
+			depth := statusDepth(line)
+			if depth > 0 && depth <= len(parents) {
+				test.Parent = parents[depth-1]
+			} else if idx := strings.LastIndex(test.Name, "/"); depth > 0 && idx > -1 {
+				test.Parent = test.Name[:idx]
+			}
+			if depth <= len(parents) {
+				parents = append(parents[:depth], test.Name)
+			}
+
 			// in ms.
 			testTime := parseTime(matches[3])
 			test.Time = testTime
-			testsTime += testTime
+			if !test.IsSubtest() {
+				testsTime += testTime
+			}
+
+			if suite := findTest(tests, test.Parent); suite != nil && suite.synthetic {
+				// the suite has no status line, it lasts as long as its
+				// methods and fails with them
+				suite.Time += testTime
+				testsTime += testTime
+				if test.Result == FAIL {
+					suite.Result = FAIL
+				}
+			}
 
 			// Caculate creation and destroy time roughly.
-			test.CreationTime = destroyStartTime.Sub(creationStartTime).Seconds()
-			test.DestroyTime = test.Time - test.CreationTime
+			setPhaseTimes(test)
+			Console.Printf("%s: creation %.3fs, destroy %.3fs\n", test.Name, test.CreationTime, test.DestroyTime)
+			for i, step := range test.destroySteps {
+				Console.Printf("%s: destroy step %d started at %s\n", test.Name, i+1, step.start.Format(time.RFC3339))
+			}
 		} else if matches := regexCoverage.FindStringSubmatch(line); len(matches) == 2 {
+			stats.Coverage++
+			if seenResult && finished != nil && finished.CoveragePct == "" {
+				// coverage printed right after the result line belongs to that
+				// package, e.g. when running with -coverpkg
+				finished.CoveragePct = matches[1]
+				continue
+			}
 			coveragePct = matches[1]
+		} else if matches := regexTotalCoverage.FindStringSubmatch(line); len(matches) == 2 {
+			stats.Coverage++
+			totals.TotalCoverage = matches[1]
+		} else if matches := regexDone.FindStringSubmatch(line); len(matches) == 6 {
+			totals.Summary = &Summary{
+				Tests:    int(parseInt(matches[1])),
+				Skipped:  int(parseInt(matches[2])),
+				Failures: int(parseInt(matches[3])),
+				Errors:   int(parseInt(matches[4])),
+				Time:     parseTime(matches[5]),
+			}
+		} else if matches := regexBenchmark.FindStringSubmatch(line); len(matches) == 6 {
+			benchmarks = append(benchmarks, &Benchmark{
+				Name:        matches[1],
+				Iterations:  parseInt(matches[2]),
+				NsPerOp:     parseTime(matches[3]),
+				BytesPerOp:  parseInt(matches[4]),
+				AllocsPerOp: parseInt(matches[5]),
+			})
 		} else if matches := regexOutput.FindStringSubmatch(line); capturedPackage == "" && len(matches) == 3 {
 			// Sub-tests start with one or more series of 4-space indents, followed by a hard tab,
 			// followed by the test output
 			// Top-level tests start with a hard tab.
-			test := findTest(tests, cur)
-			if test == nil {
+			if cur == nil {
 				continue
 			}
-			test.Output = append(test.Output, matches[2])
+			if _, isMethod := suiteName(cur.Name); isMethod {
+				// failed testify assertions continue their message on lines
+				// indented with a tab, keep them after the buffered line
+				cur.Output = append(cur.Output, buffer...)
+				buffer = buffer[0:0]
+			}
+			text := matches[2]
+			if colored != line {
+				if matches := regexOutput.FindStringSubmatch(colored); len(matches) == 3 {
+					text = matches[2]
+				}
+			}
+			if output, ok := stripOutput(opts.StripOutput, text); ok {
+				cur.Output = append(cur.Output, output)
+			}
 		} else if strings.HasPrefix(line, "# ") {
 			// indicates a capture of build output of a package. set the current build package.
 			capturedPackage = line[2:]
@@ -201,32 +1076,212 @@ func Parse(r io.Reader, pkgName string) (*Report, error) {
 		} else if regexSummary.MatchString(line) {
 			// don't store any output after the summary
 			seenSummary = true
-		} else if !seenSummary {
-			// buffer anything else that we didn't recognize
-			buffer = append(buffer, line)
+		} else if failedExample != nil && !seenSummary {
+			// the got and want output of failed examples is not indented
+			if output, ok := stripOutput(opts.StripOutput, colored); ok {
+				failedExample.Output = append(failedExample.Output, output)
+			}
+		} else {
+			// since Go 1.14 the output of tests is indented with spaces, it
+			// is buffered like unrecognized output, as are the exit status,
+			// the platform printed before benchmarks, the separators of race
+			// reports and the sections gotestsum adds before its summary
+			if line != "" && !strings.HasPrefix(line, "    ") && !regexKnownOutput.MatchString(line) {
+				unrecognized.add(lineNumber, line)
+			}
+			if !seenSummary {
+				// buffer anything else that we didn't recognize
+				if output, ok := stripOutput(opts.StripOutput, colored); ok {
+					buffer = append(buffer, output)
+				}
+			}
 		}
 	}
 
-	if len(tests) > 0 {
+	if err := flush(); err != nil {
+		return Report{}, err
+	}
+
+	if len(tests) > 0 || len(benchmarks) > 0 {
 		// no result line found
-		report.Packages = append(report.Packages, Package{
+		if pkgName == "" {
+			// fall back to the package name found in the line prefix
+			pkgName = prefix
+		}
+		finishRuns(tests)
+		err := emitPackage(Package{
 			Name:        pkgName,
 			Time:        testsTime,
 			Tests:       tests,
+			Benchmarks:  benchmarks,
 			CoveragePct: coveragePct,
+			Hostname:    hostname,
+			Setup:       setup,
 		})
+		if err != nil {
+			return Report{}, err
+		}
 	}
 
-	return report, nil
+	for _, p := range pending {
+		// interrupted packages without result line
+		finishRuns(p.tests)
+		err := emitPackage(Package{
+			Name:        p.name,
+			Time:        p.testsTime,
+			Tests:       p.tests,
+			Benchmarks:  p.benchmarks,
+			CoveragePct: p.coveragePct,
+			Hostname:    p.hostname,
+			Setup:       p.setup,
+			NoTests:     p.noTests,
+		})
+		if err != nil {
+			return Report{}, err
+		}
+	}
+
+	if opts.Stats != nil {
+		stats.Lines = lineNumber
+		stats.Unrecognized = unrecognized.Count
+		stats.UnrecognizedLines = unrecognized.Lines
+		*opts.Stats = stats
+	}
+
+	if opts.Strict && unrecognized.Count > opts.MaxUnrecognized {
+		return Report{}, unrecognized
+	}
+
+	return totals, nil
+}
+
+// Stats contains the number of lines of each kind found in go test output.
+// UnrecognizedLines contains the first lines that were not recognized, see
+// Options.Strict.
+type Stats struct {
+	Lines             int // all lines
+	Results           int // package results, e.g. "ok  package 0.1s"
+	Statuses          int // test results, e.g. "--- PASS: TestOne (0.1s)"
+	Coverage          int
+	Unrecognized      int
+	UnrecognizedLines []UnrecognizedLine
+}
+
+// maxUnrecognizedLines is the number of unrecognized lines kept as sample by
+// UnrecognizedError.
+const maxUnrecognizedLines = 10
+
+// UnrecognizedError is returned when parsing with Options.Strict if too many
+// lines were not recognized. Lines contains the first of them.
+type UnrecognizedError struct {
+	Count int
+	Lines []UnrecognizedLine
+}
+
+// UnrecognizedLine is a line which was not recognized and its line number,
+// starting at 1.
+type UnrecognizedLine struct {
+	Number int
+	Text   string
+}
+
+func (e *UnrecognizedError) add(number int, text string) {
+	e.Count++
+	if len(e.Lines) < maxUnrecognizedLines {
+		e.Lines = append(e.Lines, UnrecognizedLine{number, text})
+	}
+}
+
+func (e *UnrecognizedError) Error() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d unrecognized lines", e.Count)
+	for _, l := range e.Lines {
+		fmt.Fprintf(&b, "\n  line %d: %s", l.Number, l.Text)
+	}
+	if e.Count > len(e.Lines) {
+		fmt.Fprintf(&b, "\n  ...")
+	}
+	return b.String()
+}
+
+// failureName returns the name of a dummy test of package pkg, from the
+// given template or the default name if the template is empty.
+func failureName(template, pkg, name string) string {
+	if template == "" {
+		return name
+	}
+	return strings.Replace(template, "{package}", pkg, -1)
+}
+
+// setPhaseTimes sets the creation and destroy time of a test from the start
+// of its creation step and its destroy steps. The destroy time is the sum of
+// all destroy steps, the last one lasting until the end of the test, and the
+// rest of the test time is creation time. If only one kind of step was found,
+// that step is assumed to take the whole test time and TimesEstimated is set.
+// Times are never negative.
+func setPhaseTimes(test *Test) {
+	switch {
+	case !test.creationStart.IsZero() && len(test.destroySteps) > 0:
+		end := test.creationStart.Add(test.Duration())
+		destroyTime := 0.0
+		for _, step := range test.destroySteps {
+			stepEnd := step.end
+			if stepEnd.IsZero() {
+				stepEnd = end
+			}
+			destroyTime += math.Max(stepEnd.Sub(step.start).Seconds(), 0)
+		}
+		test.CreationTime = test.Time - destroyTime
+	case !test.creationStart.IsZero():
+		test.CreationTime = test.Time
+		test.TimesEstimated = true
+	case len(test.destroySteps) > 0:
+		test.CreationTime = 0
+		test.TimesEstimated = true
+	}
+
+	test.CreationTime = math.Max(test.CreationTime, 0)
+	test.DestroyTime = math.Max(test.Time-test.CreationTime, 0)
 }
 
-func parseTime(time string) float64 {
-	var t float64
-	t, _ = strconv.ParseFloat(time, 64)
+// stripANSI removes ANSI escape sequences, e.g. colors, from line.
+func stripANSI(line string) string {
+	if !strings.Contains(line, "\x1b") {
+		return line
+	}
+	return regexANSI.ReplaceAllString(line, "")
+}
+
+// stripOutput removes the matches of re from a line of test output. It
+// returns false if the line only consisted of matches of re and should be
+// dropped.
+func stripOutput(re *regexp.Regexp, line string) (string, bool) {
+	if re == nil || !re.MatchString(line) {
+		return line, true
+	}
+	line = re.ReplaceAllString(line, "")
+	return line, line != ""
+}
+
+func parseTime(s string) float64 {
+	t, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		// durations of long running tests are formatted like 1h2m3.45s
+		if d, err := time.ParseDuration(s + "s"); err == nil {
+			t = d.Seconds()
+		}
+	}
 
 	return t
 }
 
+func parseInt(s string) int64 {
+	var i int64
+	i, _ = strconv.ParseInt(s, 10, 64)
+
+	return i
+}
+
 func convertToRFC3339(time string) string {
 	var rfc3339Str = time
 	if matches := regexTimeFormat.FindStringSubmatch(time); len(matches) == 7 {
@@ -238,6 +1293,88 @@ func convertToRFC3339(time string) string {
 	return rfc3339Str
 }
 
+// statusDepth returns the subtest depth of a test status line, based on the
+// number of tabs or 4-space indents before it.
+func statusDepth(line string) int {
+	indent := line[:strings.Index(line, "---")]
+	return strings.Count(indent, "\t") + strings.Count(indent, "    ")
+}
+
+// rerun starts another run of test, keeping the result and output of the
+// previous runs in Runs and RunOutput. The buffered output is added to the
+// output of the previous run.
+func rerun(test *Test, buffered []string) {
+	if test.Runs == nil {
+		test.Runs = []Result{test.Result}
+	}
+	test.RunOutput = append(test.RunOutput, append(test.Output, buffered...))
+	test.Output = make([]string, 0)
+	test.Result = FAIL
+	test.TimesEstimated = false
+	test.TimedOut = false
+	test.Raced = false
+	test.SkipReason = ""
+	test.creationStart, test.destroySteps = time.Time{}, nil
+}
+
+// finishRuns adds the output of the last run to the RunOutput of tests that
+// were run more than once.
+func finishRuns(tests []*Test) {
+	for _, t := range tests {
+		if t.Runs != nil && len(t.RunOutput) < len(t.Runs) {
+			t.RunOutput = append(t.RunOutput, t.Output)
+		}
+	}
+}
+
+// packageTests holds the tests and everything else found so far of a
+// package while the output of another package is being parsed.
+type packageTests struct {
+	name        string
+	tests       []*Test
+	benchmarks  []*Benchmark
+	setup       []string
+	coveragePct string
+	hostname    string
+	noTests     bool
+	cur         *Test
+	parents     []string
+	testsTime   float64
+}
+
+func findPending(pending []*packageTests, name string) *packageTests {
+	for _, p := range pending {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// takePending returns the pending tests of the named package, if any, and the
+// remaining pending packages.
+func takePending(pending []*packageTests, name string) (*packageTests, []*packageTests) {
+	for i, p := range pending {
+		if p.name == name {
+			return p, append(pending[:i:i], pending[i+1:]...)
+		}
+	}
+	return nil, pending
+}
+
+// suiteName returns the name of the testify suite the test with the given name
+// is a method of, and whether it is one. testify runs the suite methods, whose
+// names start with Test, as subtests of the test running the suite.
+func suiteName(name string) (string, bool) {
+	idx := strings.LastIndex(name, "/")
+	if idx < 0 || !strings.HasPrefix(name[idx+1:], "Test") {
+		return "", false
+	}
+	return name[:idx], true
+}
+
+// findTest returns the most recently started test with exactly the given name.
+// Its subtests are never returned, even though their names start with it.
 func findTest(tests []*Test, name string) *Test {
 	for i := len(tests) - 1; i >= 0; i-- {
 		if tests[i].Name == name {
@@ -247,17 +1384,206 @@ func findTest(tests []*Test, name string) *Test {
 	return nil
 }
 
+// CollapsePackages returns a new report in which all packages sharing the
+// first depth elements of their import path are merged into a single package
+// named after that prefix. The tests, benchmarks and times of merged packages
+// are combined, their coverage is dropped since it can't be combined.
+func (r *Report) CollapsePackages(depth int) *Report {
+	report := &Report{Packages: make([]Package, 0), TotalCoverage: r.TotalCoverage, Summary: r.Summary}
+
+	// index in report.Packages of each collapsed package
+	indexes := map[string]int{}
+
+	for _, p := range r.Packages {
+		name := p.Name
+		if parts := strings.Split(name, "/"); len(parts) > depth {
+			name = strings.Join(parts[:depth], "/")
+		}
+
+		idx, ok := indexes[name]
+		if !ok {
+			p.Name = name
+			p.Tests = append([]*Test{}, p.Tests...)
+			indexes[name] = len(report.Packages)
+			report.Packages = append(report.Packages, p)
+			continue
+		}
+
+		merged := &report.Packages[idx]
+		merged.Time += p.Time
+		merged.Tests = append(merged.Tests, p.Tests...)
+		merged.Benchmarks = append(merged.Benchmarks, p.Benchmarks...)
+		merged.CoveragePct = ""
+		if merged.Hostname != p.Hostname {
+			merged.Hostname = ""
+		}
+	}
+
+	return report
+}
+
+// Merge adds the packages of other to r. Packages with the same name as a
+// package already in r are combined with it: their tests and benchmarks are
+// added and their times are summed. If a test is already present in the
+// package, e.g. because the package was tested again, it is replaced by the
+// test from other so the report contains the result of the last run. Whether
+// the build of a package failed is taken from its last run as well. Times are
+// rounded to milliseconds, like in the go test output.
+func (r *Report) Merge(other *Report) {
+	if other.TotalCoverage != "" {
+		r.TotalCoverage = other.TotalCoverage
+	}
+	if other.Summary != nil {
+		r.Summary = other.Summary
+	}
+
+	for _, p := range other.Packages {
+		idx := -1
+		for i := range r.Packages {
+			if r.Packages[i].Name == p.Name {
+				idx = i
+				break
+			}
+		}
+
+		if idx < 0 {
+			p.Tests = append([]*Test{}, p.Tests...)
+			r.Packages = append(r.Packages, p)
+			continue
+		}
+
+		merged := &r.Packages[idx]
+		merged.Time = math.Floor((merged.Time+p.Time)*1000+0.5) / 1000
+		if merged.BuildFailed {
+			// the dummy test of a failed build is replaced by the tests of
+			// the next run
+			merged.Tests = nil
+		}
+		merged.BuildFailed = p.BuildFailed
+		for _, t := range p.Tests {
+			replaced := false
+			for i := range merged.Tests {
+				if merged.Tests[i].Name == t.Name {
+					merged.Tests[i] = t
+					replaced = true
+					break
+				}
+			}
+			if !replaced {
+				merged.Tests = append(merged.Tests, t)
+			}
+		}
+		merged.Benchmarks = append(merged.Benchmarks, p.Benchmarks...)
+		if p.CoveragePct != "" {
+			merged.CoveragePct = p.CoveragePct
+		}
+		if p.Hostname != "" {
+			merged.Hostname = p.Hostname
+		}
+	}
+}
+
+// AllTests returns the tests of all packages in this report, in the order of
+// the packages and of their tests.
+func (r *Report) AllTests() []*Test {
+	var tests []*Test
+	for _, p := range r.Packages {
+		tests = append(tests, p.Tests...)
+	}
+	return tests
+}
+
 // Failures counts the number of failed tests in this report
 func (r *Report) Failures() int {
+	return r.count(FAIL)
+}
+
+// Skipped counts the number of skipped tests in this report
+func (r *Report) Skipped() int {
+	return r.count(SKIP)
+}
+
+// Passed counts the number of passed tests in this report
+func (r *Report) Passed() int {
+	return r.count(PASS)
+}
+
+// count counts the number of tests with the given result in this report.
+func (r *Report) count(result Result) int {
 	count := 0
+	for _, t := range r.AllTests() {
+		if t.Result == result {
+			count++
+		}
+	}
+	return count
+}
+
+// Total counts the number of tests in this report
+func (r *Report) Total() int {
+	return r.Passed() + r.Failures() + r.Skipped()
+}
+
+// Success returns false if the build of any package in this report failed or
+// any of its tests failed, like the overall result of go test.
+func (r *Report) Success() bool {
+	for _, pkg := range r.Packages {
+		if pkg.BuildFailed {
+			return false
+		}
+	}
+	return r.Failures() == 0
+}
+
+// Filter returns a new report containing only the tests for which keep
+// returns true. Packages without any remaining tests are dropped.
+func (r *Report) Filter(keep func(*Test) bool) *Report {
+	report := &Report{Packages: make([]Package, 0), TotalCoverage: r.TotalCoverage, Summary: r.Summary}
 
 	for _, p := range r.Packages {
+		tests := make([]*Test, 0)
 		for _, t := range p.Tests {
-			if t.Result == FAIL {
-				count++
+			if keep(t) {
+				tests = append(tests, t)
 			}
 		}
+		if len(tests) == 0 {
+			continue
+		}
+
+		p.Tests = tests
+		report.Packages = append(report.Packages, p)
 	}
 
-	return count
+	return report
+}
+
+// FilterByDuration returns a new report containing only the tests that took
+// at least min seconds. Packages without any remaining tests are dropped.
+func (r *Report) FilterByDuration(min float64) *Report {
+	return r.Filter(func(t *Test) bool {
+		return t.Time >= min
+	})
+}
+
+// SlowTests returns the tests of all packages which took longer than
+// threshold seconds, the slowest first.
+func (r *Report) SlowTests(threshold float64) []*Test {
+	var slow []*Test
+	for _, t := range r.AllTests() {
+		if t.Time > threshold {
+			slow = append(slow, t)
+		}
+	}
+	sort.SliceStable(slow, func(i, j int) bool {
+		return slow[i].Time > slow[j].Time
+	})
+	return slow
+}
+
+// MarkSlow sets Slow for the tests returned by SlowTests.
+func (r *Report) MarkSlow(threshold float64) {
+	for _, t := range r.SlowTests(threshold) {
+		t.Slow = true
+	}
 }
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metacpp/go-junit-report/formatter"
+	"github.com/metacpp/go-junit-report/parser"
+)
+
+// maxRequestSize is the maximum size of the go test output accepted by the
+// server started with -serve.
+const maxRequestSize = 32 << 20
+
+// reportHandler returns a handler which reads the report of the go test
+// output posted to it with read and responds with it in the format selected by
+// the Accept header of the request. JUnit XML is written unless JSON, CSV,
+// HTML or TAP is accepted.
+func reportHandler(read func(io.Reader) (*parser.Report, error), goVersion string, xmlOpts formatter.Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		contentType, write := negotiateFormat(r.Header.Get("Accept"), goVersion, xmlOpts)
+		if write == nil {
+			http.Error(w, "supported formats are application/xml, application/json, text/csv, text/html and text/x-tap", http.StatusNotAcceptable)
+			return
+		}
+
+		// read one byte more than allowed to find out if the body is too large
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading input: %s", err), http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxRequestSize {
+			http.Error(w, fmt.Sprintf("request body larger than %d bytes", maxRequestSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		report, err := read(bytes.NewReader(body))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading input: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		var out bytes.Buffer
+		if err := write(report, &out); err != nil {
+			http.Error(w, fmt.Sprintf("Error writing report: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Write(out.Bytes())
+	})
+}
+
+// negotiateFormat returns the content type and formatter of the media type in
+// the accept header with the highest quality that is supported, or a nil
+// formatter if none is.
+func negotiateFormat(accept, goVersion string, xmlOpts formatter.Options) (string, func(*parser.Report, *bytes.Buffer) error) {
+	if xmlOpts.Timestamp.IsZero() {
+		xmlOpts.Timestamp = time.Now()
+	}
+
+	writeXML := func(report *parser.Report, w *bytes.Buffer) error {
+		return formatter.JUnitReportXMLWithOptions(report, false, goVersion, xmlOpts, w)
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return "application/xml", writeXML
+	}
+
+	for _, mediaType := range acceptedTypes(accept) {
+		switch mediaType {
+		case "application/xml", "text/xml", "application/*", "*/*":
+			return "application/xml", writeXML
+		case "application/json":
+			return "application/json", func(report *parser.Report, w *bytes.Buffer) error {
+				return formatter.JSONReportWithOptions(report, goVersion, xmlOpts, w)
+			}
+		case "text/csv":
+			return "text/csv", func(report *parser.Report, w *bytes.Buffer) error {
+				return formatter.CSVReport(report, w)
+			}
+		case "text/html":
+			return "text/html", func(report *parser.Report, w *bytes.Buffer) error {
+				return formatter.HTMLReport(report, w)
+			}
+		case "text/x-tap", "text/plain", "text/*":
+			return "text/plain", func(report *parser.Report, w *bytes.Buffer) error {
+				return formatter.TAPReport(report, w)
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// acceptedTypes returns the media types of an accept header, ordered by their
+// quality. Media types of the same quality keep their order, media types with
+// a quality of 0 are not acceptable and left out.
+func acceptedTypes(accept string) []string {
+	type acceptedType struct {
+		mediaType string
+		quality   float64
+	}
+
+	var types []acceptedType
+	for _, mediaType := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaType)
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			types = append(types, acceptedType{mediaType, quality})
+		}
+	}
+
+	sort.SliceStable(types, func(i, j int) bool {
+		return types[i].quality > types[j].quality
+	})
+
+	mediaTypes := make([]string, len(types))
+	for i, t := range types {
+		mediaTypes[i] = t.mediaType
+	}
+	return mediaTypes
+}